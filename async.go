@@ -0,0 +1,30 @@
+package builder
+
+// OutputResult is the result of running a command with OutputAsync
+type OutputResult struct {
+	Output string
+	Err    error
+}
+
+// RunAsync runs the command in a goroutine. The error returned by Run is sent
+// on the returned channel, which is then closed.
+func (cmdBuilder *CmdBuilder) RunAsync() <-chan error {
+	result := make(chan error, 1)
+	go func() {
+		defer close(result)
+		result <- cmdBuilder.Run()
+	}()
+	return result
+}
+
+// OutputAsync is like RunAsync except the output and error returned
+// by Output are sent on the returned channel
+func (cmdBuilder *CmdBuilder) OutputAsync() <-chan OutputResult {
+	result := make(chan OutputResult, 1)
+	go func() {
+		defer close(result)
+		output, err := cmdBuilder.Output()
+		result <- OutputResult{Output: output, Err: err}
+	}()
+	return result
+}
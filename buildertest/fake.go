@@ -0,0 +1,234 @@
+// Package buildertest provides a fake builder.Runner for testing code
+// that shells out without spawning real processes.
+package buildertest
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	builder "github.com/Stage2Sec/cmd-builder"
+)
+
+// ErrUnexpectedCommand is returned when running a command that doesn't
+// match any of the fake's rules
+var ErrUnexpectedCommand = errors.New("unexpected command")
+
+// Invocation is a command run through a FakeRunner
+type Invocation struct {
+	Name string
+	Args []string
+}
+
+// String returns a shell-like representation of the command
+func (invocation Invocation) String() string {
+	return builder.Cmd(invocation.Name, invocation.Args...).String()
+}
+
+// Response is the canned result of the commands matching a rule
+type Response struct {
+	Stdout string
+	Stderr string
+	// ExitCode is the exit code the command exits with. A non-zero exit code
+	// fails the command with a *builder.CmdError wrapping a *builder.ExitStatusError.
+	ExitCode int
+	// Err is returned instead of running the command, e.g. to fake
+	// a command that fails to start
+	Err error
+}
+
+// Matcher reports whether a command is handled by a rule
+type Matcher func(name string, args []string) bool
+
+// Exact matches the command with exactly the name and arguments
+func Exact(name string, args ...string) Matcher {
+	return func(n string, a []string) bool {
+		return n == name && equal(a, args)
+	}
+}
+
+// Prefix matches the commands with the name whose arguments start with args
+func Prefix(name string, args ...string) Matcher {
+	return func(n string, a []string) bool {
+		return n == name && len(a) >= len(args) && equal(a[:len(args)], args)
+	}
+}
+
+// Any matches every command
+func Any() Matcher {
+	return func(string, []string) bool {
+		return true
+	}
+}
+
+// equal reports whether the arguments are the same
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type rule struct {
+	match    Matcher
+	response Response
+}
+
+// FakeRunner creates fake commands that record their invocations and return
+// the canned response of the first rule matching them. Commands matching no rule
+// fail with ErrUnexpectedCommand. Inject FakeRunner.Cmd where the code under test
+// expects a builder.RunnerFunc. A FakeRunner is safe for concurrent use.
+type FakeRunner struct {
+	mu    sync.Mutex
+	rules []rule
+	calls []Invocation
+}
+
+// NewFakeRunner returns a FakeRunner without any rules
+func NewFakeRunner() *FakeRunner {
+	return &FakeRunner{}
+}
+
+// On adds a rule responding to the commands matched by match with response.
+// Rules are matched in the order they were added.
+func (fake *FakeRunner) On(match Matcher, response Response) *FakeRunner {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.rules = append(fake.rules, rule{match: match, response: response})
+	return fake
+}
+
+// Cmd returns a fake command that is recorded and resolved when it's run
+func (fake *FakeRunner) Cmd(name string, args ...string) builder.Runner {
+	return &fakeCmd{
+		fake:       fake,
+		invocation: Invocation{Name: name, Args: append([]string(nil), args...)},
+	}
+}
+
+// Calls returns the commands that have been run, in order
+func (fake *FakeRunner) Calls() []Invocation {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	return append([]Invocation(nil), fake.calls...)
+}
+
+// Called reports whether the command with exactly the name and arguments has been run
+func (fake *FakeRunner) Called(name string, args ...string) bool {
+	match := Exact(name, args...)
+	for _, call := range fake.Calls() {
+		if match(call.Name, call.Args) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reset forgets the commands that have been run, keeping the rules
+func (fake *FakeRunner) Reset() {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.calls = nil
+}
+
+// run records the invocation and returns the response of the first rule matching it
+func (fake *FakeRunner) run(invocation Invocation) (Response, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	fake.calls = append(fake.calls, invocation)
+	for _, rule := range fake.rules {
+		if rule.match(invocation.Name, invocation.Args) {
+			return rule.response, nil
+		}
+	}
+	return Response{}, ErrUnexpectedCommand
+}
+
+// fakeCmd is a command created by a FakeRunner
+type fakeCmd struct {
+	fake       *FakeRunner
+	invocation Invocation
+
+	started  bool
+	response Response
+	err      error
+}
+
+func (cmd *fakeCmd) Run() error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Wait()
+}
+
+func (cmd *fakeCmd) Output() (string, error) {
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(cmd.response.Stdout), nil
+}
+
+func (cmd *fakeCmd) Capture() (builder.RunResult, error) {
+	if err := cmd.Start(); err != nil {
+		return builder.RunResult{ExitCode: -1, Err: err}, err
+	}
+	return builder.RunResult{
+		Stdout:   strings.TrimSpace(cmd.response.Stdout),
+		Stderr:   strings.TrimSpace(cmd.response.Stderr),
+		ExitCode: cmd.response.ExitCode,
+		Err:      cmd.Wait(),
+	}, nil
+}
+
+func (cmd *fakeCmd) ExitCode() (int, error) {
+	if err := cmd.Run(); err != nil && cmd.err != nil {
+		return -1, err
+	}
+	return cmd.response.ExitCode, nil
+}
+
+func (cmd *fakeCmd) Start() error {
+	if cmd.started {
+		return errors.New("command already started")
+	}
+	cmd.started = true
+
+	cmd.response, cmd.err = cmd.fake.run(cmd.invocation)
+	if cmd.err == nil {
+		cmd.err = cmd.response.Err
+	}
+	if cmd.err != nil {
+		return cmd.cmdError(-1, cmd.err)
+	}
+	return nil
+}
+
+func (cmd *fakeCmd) Wait() error {
+	if !cmd.started {
+		return errors.New("command not started")
+	}
+	if cmd.err != nil {
+		return cmd.cmdError(-1, cmd.err)
+	}
+	if cmd.response.ExitCode == 0 {
+		return nil
+	}
+	return cmd.cmdError(cmd.response.ExitCode, &builder.ExitStatusError{Code: cmd.response.ExitCode})
+}
+
+// cmdError describes the failed command like the errors of a builder
+func (cmd *fakeCmd) cmdError(exitCode int, err error) error {
+	return &builder.CmdError{
+		Name:     cmd.invocation.Name,
+		Args:     cmd.invocation.Args,
+		ExitCode: exitCode,
+		Stderr:   strings.TrimSpace(cmd.response.Stderr),
+		Err:      err,
+	}
+}
@@ -0,0 +1,66 @@
+//go:build unix
+
+package buildertest
+
+import (
+	"errors"
+	"testing"
+
+	builder "github.com/Stage2Sec/cmd-builder"
+)
+
+// runners create the same failing command with a real and a fake runner
+func runners() map[string]builder.RunnerFunc {
+	fake := NewFakeRunner().On(Any(), Response{Stdout: "out\n", Stderr: "err\n", ExitCode: 3})
+	return map[string]builder.RunnerFunc{
+		"real": func(string, ...string) builder.Runner {
+			return builder.Cmd("sh", "-c", "echo out; echo err >&2; exit 3").Stderr(nil)
+		},
+		"fake": fake.Cmd,
+	}
+}
+
+func TestFakeExitMatchesRealRunner(t *testing.T) {
+	for name, cmd := range runners() {
+		t.Run(name, func(t *testing.T) {
+			result, err := cmd("tool").Capture()
+			if err != nil {
+				t.Fatalf("Capture() error = %v", err)
+			}
+			if result.ExitCode != 3 || result.Stdout != "out" || result.Stderr != "err" || result.Err == nil {
+				t.Errorf("Capture() = %+v, want exit code 3 with the output", result)
+			}
+
+			code, err := cmd("tool").ExitCode()
+			if code != 3 || err != nil {
+				t.Errorf("ExitCode() = %d, %v, want 3, nil", code, err)
+			}
+
+			var cmdErr *builder.CmdError
+			if err := cmd("tool").Run(); !errors.As(err, &cmdErr) || cmdErr.ExitCode != 3 {
+				t.Errorf("Run() = %v, want a *builder.CmdError with exit code 3", err)
+			}
+		})
+	}
+}
+
+func TestFakeWaitAfterFailedStart(t *testing.T) {
+	fake := NewFakeRunner()
+	cmd := fake.Cmd("missing")
+
+	if err := cmd.Start(); !errors.Is(err, ErrUnexpectedCommand) {
+		t.Fatalf("Start() = %v, want ErrUnexpectedCommand", err)
+	}
+	if err := cmd.Wait(); !errors.Is(err, ErrUnexpectedCommand) {
+		t.Errorf("Wait() = %v, want ErrUnexpectedCommand", err)
+	}
+
+	code, err := fake.Cmd("missing").ExitCode()
+	if code != -1 || !errors.Is(err, ErrUnexpectedCommand) {
+		t.Errorf("ExitCode() = %d, %v, want -1, ErrUnexpectedCommand", code, err)
+	}
+	result, err := fake.Cmd("missing").Capture()
+	if result.ExitCode != -1 || !errors.Is(err, ErrUnexpectedCommand) {
+		t.Errorf("Capture() = %+v, %v, want exit code -1 and ErrUnexpectedCommand", result, err)
+	}
+}
@@ -0,0 +1,45 @@
+package builder
+
+import (
+	"context"
+)
+
+// chainStep is a builder chained onto another with Then or OrElse
+type chainStep struct {
+	builder *CmdBuilder
+	// orElse is true if the step runs only when the chain so far failed
+	orElse bool
+}
+
+// Then chains next onto the command so that running the command with Run or
+// RunContext runs next only if everything before it in the chain succeeded,
+// like '&&' in the shell. Then returns the head of the chain so calls can be chained,
+// e.g. Cmd("go", "build").Then(Cmd("go", "test")).Then(Cmd("go", "vet")).Run()
+// The chain is run by Run, RunContext, MustRun, RunAsync, Success, and ExitCode.
+// Start, Output, Capture, and the like run the command on its own.
+func (cmdBuilder *CmdBuilder) Then(next *CmdBuilder) *CmdBuilder {
+	cmdBuilder.chain = append(cmdBuilder.chain, chainStep{builder: next})
+	return cmdBuilder
+}
+
+// OrElse chains fallback onto the command so that it runs only if the chain
+// before it failed, like '||' in the shell. OrElse returns the head of the chain.
+func (cmdBuilder *CmdBuilder) OrElse(fallback *CmdBuilder) *CmdBuilder {
+	cmdBuilder.chain = append(cmdBuilder.chain, chainStep{builder: fallback, orElse: true})
+	return cmdBuilder
+}
+
+// runChain runs the steps chained onto the command given the error the command
+// exited with and returns the error of the last step that ran
+func (cmdBuilder *CmdBuilder) runChain(ctx context.Context, err error) error {
+	for _, step := range cmdBuilder.chain {
+		if ctx.Err() != nil {
+			break
+		}
+
+		if (err == nil) != step.orElse {
+			err = step.builder.RunContext(ctx)
+		}
+	}
+	return err
+}
@@ -0,0 +1,23 @@
+//go:build !unix
+
+package builder
+
+import (
+	"errors"
+	"runtime"
+)
+
+// ErrChrootUnsupported is returned when changing the root directory of a command
+// isn't supported on the current OS
+var ErrChrootUnsupported = errors.New("changing the root directory is unsupported on " + runtime.GOOS)
+
+// Chroot is unsupported on Windows and other systems that aren't Unix.
+// The command returns ErrChrootUnsupported when started.
+func (cmdBuilder *CmdBuilder) Chroot(dir string) *CmdBuilder {
+	cmdBuilder.setErr(ErrChrootUnsupported)
+	return cmdBuilder
+}
+
+func (cmdBuilder *CmdBuilder) root() string {
+	return ""
+}
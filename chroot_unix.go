@@ -0,0 +1,36 @@
+//go:build unix
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrChrootUnprivileged is returned when the command is started if Chroot was
+// used by a process that isn't running as root
+var ErrChrootUnprivileged = errors.New("changing the root directory requires root privileges")
+
+// Chroot runs the command with its root directory changed to dir. The program is
+// resolved by the current process, so it must exist at the same path within dir,
+// and the working directory set with Dir is relative to the new root.
+// The calling process must be running as root, otherwise the error is returned
+// when the command is started.
+func (cmdBuilder *CmdBuilder) Chroot(dir string) *CmdBuilder {
+	if os.Geteuid() != 0 {
+		cmdBuilder.setErr(fmt.Errorf("chroot %s: %w", dir, ErrChrootUnprivileged))
+		return cmdBuilder
+	}
+
+	cmdBuilder.sysProcAttr().Chroot = dir
+	return cmdBuilder
+}
+
+// root returns the directory the command's root is changed to, if any
+func (cmdBuilder *CmdBuilder) root() string {
+	if cmdBuilder.cmd.SysProcAttr == nil {
+		return ""
+	}
+	return cmdBuilder.cmd.SysProcAttr.Chroot
+}
@@ -0,0 +1,95 @@
+package builder
+
+import (
+	"context"
+	"os"
+	"os/exec"
+)
+
+// Clone returns a copy of the builder with a fresh 'exec.Cmd' so the copy can be
+// modified and run without affecting the original. The args, env, and other
+// options are copied. Configured streams are shared between the copies.
+// If the builder is the last stage of a pipeline, every stage is cloned, and so is
+// every builder chained onto it with Then or OrElse.
+func (cmdBuilder *CmdBuilder) Clone() *CmdBuilder {
+	clone := *cmdBuilder
+	clone.cmd = copyCmd(cmdBuilder.ctx, cmdBuilder.cmd)
+	clone.state = runState{}
+	// a pipe is read by a single run of the original
+	clone.releasePipes()
+
+	// cap the shared slices so appending to one copy doesn't affect the other
+	clone.teeStdout = cmdBuilder.teeStdout[:len(cmdBuilder.teeStdout):len(cmdBuilder.teeStdout)]
+	clone.teeStderr = cmdBuilder.teeStderr[:len(cmdBuilder.teeStderr):len(cmdBuilder.teeStderr)]
+	clone.stdoutLines = cmdBuilder.stdoutLines[:len(cmdBuilder.stdoutLines):len(cmdBuilder.stdoutLines)]
+	clone.stderrLines = cmdBuilder.stderrLines[:len(cmdBuilder.stderrLines):len(cmdBuilder.stderrLines)]
+	clone.maskArgs = cmdBuilder.maskArgs[:len(cmdBuilder.maskArgs):len(cmdBuilder.maskArgs)]
+	clone.maskEnv = cmdBuilder.maskEnv[:len(cmdBuilder.maskEnv):len(cmdBuilder.maskEnv)]
+	clone.allowExitCodes = cmdBuilder.allowExitCodes[:len(cmdBuilder.allowExitCodes):len(cmdBuilder.allowExitCodes)]
+	clone.rlimits = cmdBuilder.rlimits[:len(cmdBuilder.rlimits):len(cmdBuilder.rlimits)]
+	clone.onStart = cmdBuilder.onStart[:len(cmdBuilder.onStart):len(cmdBuilder.onStart)]
+	clone.onExit = cmdBuilder.onExit[:len(cmdBuilder.onExit):len(cmdBuilder.onExit)]
+	clone.onRetry = cmdBuilder.onRetry[:len(cmdBuilder.onRetry):len(cmdBuilder.onRetry)]
+	clone.onComplete = cmdBuilder.onComplete[:len(cmdBuilder.onComplete):len(cmdBuilder.onComplete)]
+
+	if cmdBuilder.prev != nil {
+		clone.prev = cmdBuilder.prev.Clone()
+	}
+	if cmdBuilder.chain != nil {
+		clone.chain = make([]chainStep, len(cmdBuilder.chain))
+		for i, step := range cmdBuilder.chain {
+			clone.chain[i] = chainStep{builder: step.builder.Clone(), orElse: step.orElse}
+		}
+	}
+
+	return &clone
+}
+
+// Reset replaces the underlying 'exec.Cmd' with a fresh copy so the builder can be
+// run again after a run, e.g. in a polling loop. The args, env, and other options
+// are kept. Streams are reused as they are, so a reader already consumed by a
+// previous run, like a strings.Reader given to Stdin, won't be read from the start.
+// If the builder is the last stage of a pipeline, every stage is reset, and so is
+// every builder chained onto it with Then or OrElse. Reset must not be called while the command is running.
+func (cmdBuilder *CmdBuilder) Reset() *CmdBuilder {
+	for _, stage := range cmdBuilder.stages() {
+		stage.rebuild()
+		stage.state = runState{}
+	}
+	for _, step := range cmdBuilder.chain {
+		step.builder.Reset()
+	}
+	return cmdBuilder
+}
+
+// rebuild replaces the underlying exec.Cmd with a fresh copy that can be started
+func (cmdBuilder *CmdBuilder) rebuild() {
+	cmdBuilder.cmd = copyCmd(cmdBuilder.ctx, cmdBuilder.cmd)
+}
+
+// copyCmd returns a new, unstarted exec.Cmd with the same configuration as old
+func copyCmd(ctx context.Context, old *exec.Cmd) *exec.Cmd {
+	var cmd *exec.Cmd
+	if ctx != nil {
+		cmd = exec.CommandContext(ctx, old.Path, old.Args[1:]...)
+	} else {
+		cmd = exec.Command(old.Path, old.Args[1:]...)
+	}
+
+	cmd.Args[0] = old.Args[0]
+	cmd.Dir = old.Dir
+	if old.Env != nil {
+		cmd.Env = append([]string{}, old.Env...)
+	}
+	cmd.Stdin = old.Stdin
+	cmd.Stdout = old.Stdout
+	cmd.Stderr = old.Stderr
+	cmd.WaitDelay = old.WaitDelay
+	cmd.ExtraFiles = append([]*os.File(nil), old.ExtraFiles...)
+	if old.SysProcAttr != nil {
+		attr := *old.SysProcAttr
+		cmd.SysProcAttr = &attr
+	}
+
+	return cmd
+}
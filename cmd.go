@@ -1,18 +1,44 @@
 package builder
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
+// DefaultKillGrace is the default amount of time a timed out command has to exit
+// after being signaled before it is killed
+const DefaultKillGrace = 5 * time.Second
+
 // CmdFactory allows you to create builder structs that
-// use the same options
+// use the same options.
+//
+// A factory can be shared by multiple goroutines since creating a builder only reads
+// the options. However, the builders share the Stdin, Stdout, and Stderr of the options,
+// so commands running concurrently may interleave writes to the same writer in a
+// way that isn't safe for writers like bytes.Buffer. Set SyncStreams to serialize
+// the writes. Sharing Stdin between concurrent commands is never safe.
 type CmdFactory struct {
 	Options CmdFactoryOptions
+	// ctx is the context every builder is bound to, if the factory was created
+	// with NewFactoryContext
+	ctx context.Context
+	// events publishes the events of the builders created by the factory, see Events
+	events *eventHub
 }
 
 // CmdFactoryOptions represents the configurable options for creating builders
@@ -21,21 +47,128 @@ type CmdFactoryOptions struct {
 	Stdin  io.Reader
 	Stdout io.Writer
 	Stderr io.Writer
-	Dir    string
+	// SyncStreams wraps Stdout and Stderr in a SyncWriter when the factory is
+	// created with NewFactory, so they can be shared by concurrent commands
+	SyncStreams bool
+	Dir         string
+	// Env and EnvMap are layered on top of the inherited environment, and
+	// variables set on a builder are layered on top of them. When a key is set
+	// in more than one layer the last layer wins.
 	Env    []string
+	EnvMap map[string]string
+	// EnvFiles are dotenv files read into the environment of every builder
+	// created by the factory, in order and before Env and EnvMap.
+	// See CmdBuilder.EnvFile
+	EnvFiles []string
+	// InheritEnv controls whether builders start from the current process's
+	// environment. A nil InheritEnv inherits the environment unless disabled
+	// with SetInheritEnv.
+	InheritEnv *bool
+	// Shell is the shell used by the factory's Shell method instead of the OS shell
+	Shell string
+	// ShellFlag is the flag used to pass the command string to Shell. Defaults to "-c"
+	ShellFlag string
+	// Timeout is the default timeout of every builder created by the factory,
+	// which can be overridden per builder. See CmdBuilder.Timeout
+	Timeout time.Duration
+	// KillGrace is the default kill grace period of every builder created by the
+	// factory. Defaults to DefaultKillGrace. See CmdBuilder.KillGrace
+	KillGrace time.Duration
+	// OnStart hooks are registered on every builder created by the factory
+	// before any hooks registered on the builder. See CmdBuilder.OnStart
+	OnStart []func(cmd *exec.Cmd)
+	// OnExit hooks are registered on every builder created by the factory
+	// before any hooks registered on the builder. See CmdBuilder.OnExit
+	OnExit []func(cmd *exec.Cmd, err error)
+	// DryRun causes every builder created by the factory to write its
+	// command line to DryRun instead of executing. See CmdBuilder.DryRun
+	DryRun io.Writer
 }
 
 // NewFactory creates a new CmdFactory struct with the specified CmdFactoryOptions
 func NewFactory(options CmdFactoryOptions) CmdFactory {
+	if options.SyncStreams {
+		shared := sameWriter(options.Stdout, options.Stderr)
+		if options.Stdout != nil {
+			options.Stdout = syncStream(options.Stdout)
+		}
+
+		if shared {
+			options.Stderr = options.Stdout
+		} else if options.Stderr != nil {
+			options.Stderr = syncStream(options.Stderr)
+		}
+	}
+
 	return CmdFactory{
 		Options: options,
+		events:  &eventHub{},
 	}
 }
 
+// NewFactoryContext is like NewFactory except every builder created by the factory
+// is bound to ctx, so every running command is killed once ctx is done,
+// e.g. when a service holding a long-lived factory shuts down.
+func NewFactoryContext(ctx context.Context, options CmdFactoryOptions) CmdFactory {
+	factory := NewFactory(options)
+	factory.ctx = ctx
+	return factory
+}
+
 // Cmd returns the CmdBuilder struct built from the factory's options,
 // that can be used to build/execute 'exec.Cmd` structs.
+// If the factory was created with NewFactoryContext the builder is bound to its context.
 func (factory CmdFactory) Cmd(name string, args ...string) *CmdBuilder {
-	builder := Cmd(name, args...)
+	if factory.ctx != nil {
+		return factory.apply(newCmdContext(factory.ctx, name, args...))
+	}
+	return factory.apply(newCmd(name, args...))
+}
+
+// CmdContext is like Cmd but the command is bound to the provided context.
+// The process will be killed if the context is done before the command completes.
+// The provided context replaces the factory's context, if any, so it should be
+// derived from it for the command to be killed when either is done.
+func (factory CmdFactory) CmdContext(ctx context.Context, name string, args ...string) *CmdBuilder {
+	return factory.apply(newCmdContext(ctx, name, args...))
+}
+
+// BoundCmd creates builders for a program whose invocations all start with the same
+// arguments, e.g. "kubectl --context=prod", using the options of a factory
+type BoundCmd struct {
+	factory CmdFactory
+	name    string
+	args    []string
+}
+
+// With returns a BoundCmd creating builders for the program with the base arguments,
+// followed by the arguments given to each builder
+func (factory CmdFactory) With(name string, baseArgs ...string) BoundCmd {
+	return BoundCmd{
+		factory: factory,
+		name:    name,
+		args:    append([]string(nil), baseArgs...),
+	}
+}
+
+// Cmd returns a builder for the program with the base arguments followed by args
+func (bound BoundCmd) Cmd(args ...string) *CmdBuilder {
+	return bound.factory.Cmd(bound.name, bound.withArgs(args)...)
+}
+
+// CmdContext is like Cmd but the command is bound to the provided context.
+// See CmdFactory.CmdContext.
+func (bound BoundCmd) CmdContext(ctx context.Context, args ...string) *CmdBuilder {
+	return bound.factory.CmdContext(ctx, bound.name, bound.withArgs(args)...)
+}
+
+// withArgs returns a new slice of the base arguments followed by args
+func (bound BoundCmd) withArgs(args []string) []string {
+	return append(bound.args[:len(bound.args):len(bound.args)], args...)
+}
+
+// apply sets the factory's options on the builder
+func (factory CmdFactory) apply(builder *CmdBuilder) *CmdBuilder {
 	if factory.Options.Stdin != nil {
 		builder.cmd.Stdin = factory.Options.Stdin
 	}
@@ -52,76 +185,491 @@ func (factory CmdFactory) Cmd(name string, args ...string) *CmdBuilder {
 		builder.cmd.Dir = factory.Options.Dir
 	}
 
+	if factory.Options.InheritEnv != nil {
+		if *factory.Options.InheritEnv {
+			builder.cmd.Env = os.Environ()
+		} else {
+			builder.ClearEnv()
+		}
+	}
+
+	for _, path := range factory.Options.EnvFiles {
+		builder.EnvFile(path)
+	}
+
 	if len(factory.Options.Env) > 0 {
-		builder.cmd.Env = append(builder.cmd.Env, factory.Options.Env...)
+		builder.cmd.Env = dedupEnv(append(builder.cmd.Env, factory.Options.Env...))
+	}
+
+	if len(factory.Options.EnvMap) > 0 {
+		builder.cmd.Env = setEnvMap(builder.cmd.Env, factory.Options.EnvMap)
+	}
+
+	if factory.Options.DryRun != nil {
+		builder.dryRun = factory.Options.DryRun
+	}
+
+	if factory.Options.Timeout > 0 {
+		builder.timeout = factory.Options.Timeout
+	}
+
+	if factory.Options.KillGrace > 0 {
+		builder.killGrace = factory.Options.KillGrace
+	}
+
+	for _, fn := range factory.Options.OnStart {
+		builder.OnStart(fn)
+	}
+
+	for _, fn := range factory.Options.OnExit {
+		builder.OnExit(fn)
+	}
+
+	if factory.events != nil && factory.events.subscribed() {
+		factory.events.publishEvents(builder)
 	}
 
 	return builder
 }
 
 // Shell is like Cmd except it passes the arg string to the OS shell.
-//
-// Linux: 'bash -c'
-//
-// macOS: 'zsh -c'
-//
-// Windows: 'powershell -Command'
-//
-// Everything else: '$SHELL -c'
+// If the factory's Shell option is set, that shell is used instead.
+// See the package level Shell function for the defaults.
 func (factory CmdFactory) Shell(args string) *CmdBuilder {
-	switch runtime.GOOS {
-	default:
-		return factory.Cmd(os.Getenv("SHELL"), "-c", args)
-	case "linux":
-		return factory.Cmd("bash", "-c", args)
-	case "darwin":
-		return factory.Cmd("zsh", "-c", args)
-	case "windows":
-		return factory.Cmd("powershell", "-Command", args)
+	if factory.Options.Shell != "" {
+		flag := factory.Options.ShellFlag
+		if flag == "" {
+			flag = "-c"
+		}
+		return factory.ShellWith(factory.Options.Shell, flag, args)
+	}
+
+	shell, flag := defaultShell()
+	return factory.ShellWith(shell, flag, args)
+}
+
+// ShellWith is like Shell except it uses the specified shell and flag,
+// e.g. ShellWith("fish", "-c", args)
+func (factory CmdFactory) ShellWith(shell string, flag string, args string) *CmdBuilder {
+	return factory.Cmd(shell, flag, args).shellArgs(shell, flag, args)
+}
+
+// ShellCmdExe is like Shell except it uses 'cmd /c' on Windows.
+// See the package level ShellCmdExe function.
+func (factory CmdFactory) ShellCmdExe(args string) *CmdBuilder {
+	if runtime.GOOS != "windows" {
+		return factory.Shell(args)
 	}
+	return factory.ShellWith("cmd", "/c", args)
 }
 
 // CmdBuilder represents an 'exec.Cmd' struct using the builder design pattern
 type CmdBuilder struct {
 	cmd *exec.Cmd
+	// ctx is the context the builder was created with, if any
+	ctx context.Context
+	// name is the name of the program the builder was created with
+	name string
+	// shell is the lowercase base name of the shell if the builder was created with Shell
+	shell    string
+	pipeFail bool
+	// err is the first error encountered while configuring the builder.
+	// It is returned when the command is started so the builder stays chainable.
+	err error
+
+	// rawOutput is true if the returned output isn't trimmed
+	rawOutput bool
+	// trimCutset is the cutset the returned output is trimmed with instead of white space
+	trimCutset *string
+
+	// allowExitCodes are the non-zero exit codes treated as success
+	allowExitCodes []int
+
+	// mkdirDir is true if the working directory is created before the command is started
+	mkdirDir bool
+
+	timeout   time.Duration
+	deadline  time.Time
+	killGrace time.Duration
+	// cancel stops the process when its context is done instead of killing it
+	cancel func() error
+	// cancelSignal is sent to the process when its context is done instead of killing it, if set
+	cancelSignal os.Signal
+	// killTree is true if the process's children are stopped along with it
+	killTree bool
+
+	attempts    int
+	shouldRetry func(err error) bool
+	backoff     func(attempt int) time.Duration
+	onRetry     []func(attempt int, err error)
+
+	dryRun io.Writer
+
+	teeStdout   []io.Writer
+	teeStderr   []io.Writer
+	mergeStderr bool
+	prefix      string
+	stripANSI   bool
+	pty         bool
+	// rawTerminal is true if the terminal of the PTY's stdin is put into raw mode
+	rawTerminal bool
+
+	// expandArgs is true if the arguments are expanded using the command's environment
+	expandArgs    bool
+	expandUnknown func(name string) string
+
+	// maskArgs and maskEnv hide secrets when the command is rendered
+	maskArgs []*regexp.Regexp
+	maskEnv  []string
+
+	// maxOutput is the maximum number of bytes captured from each stream, if positive
+	maxOutput int64
+	// tail is the number of trailing lines captured from each stream, if positive
+	tail int
+
+	// forwardSignals are the signals relayed to the process while it runs
+	forwardSignals []os.Signal
+
+	// heartbeat is called every heartbeatInterval while the command runs, if set
+	heartbeatInterval time.Duration
+	heartbeat         func(elapsed time.Duration)
+
+	// umask is the umask to run the command with, if set
+	umask *int
+	// rlimits are the resource limits to run the command with
+	rlimits []rlimit
+
+	// nice is the niceness to run the command with, if set
+	nice *int
+	// piped is true if the command's stdout is piped into the next stage of a pipeline
+	piped bool
+	// stdoutPipe and stderrPipe are set up by StdoutPipe and StderrPipe for the next run
+	stdoutPipe *outputPipe
+	stderrPipe *outputPipe
+
+	// split splits the output into the lines passed to the line functions and
+	// returned by Lines, if set
+	split bufio.SplitFunc
+	// keepCRLF is true if Lines only splits by "\n"
+	keepCRLF bool
+
+	// decode wraps the writers the output is captured into to decode it, if set
+	decode func(w io.Writer) io.Writer
+
+	// stdoutLines and stderrLines are called with each line of the output, e.g.
+	// the functions registered with StreamStderr
+	stdoutLines []func(line string)
+	stderrLines []func(line string)
+	// stdoutEvent and stderrEvent publish the lines of the output to the factory's
+	// Events, unless the stream is read through a pipe
+	stdoutEvent func(line string)
+	stderrEvent func(line string)
+
+	// captureStdout and captureStderr capture the output of the current run
+	captureStdout io.Writer
+	captureStderr io.Writer
+
+	onStart    []func(cmd *exec.Cmd)
+	onExit     []func(cmd *exec.Cmd, err error)
+	onComplete []func(d time.Duration, err error)
+
+	// chain holds the builders chained onto the command with Then and OrElse
+	chain []chainStep
+
+	// prev is the previous stage of the pipeline, if any
+	prev *CmdBuilder
+
+	state runState
+}
+
+// runState holds the state of the current or last run of the command
+type runState struct {
+	// ctx is the context the run is bound to
+	ctx      context.Context
+	started  time.Time
+	duration time.Duration
+	done     chan struct{}
+	timedOut chan bool
+	// canceled is set by watch to the context whose being done stopped the process:
+	// the context of the run or the one the builder was created with
+	canceled context.Context
+	// cancelErr is the error of the Cancel function or CancelSignal, in which case
+	// the process was killed instead
+	cancelErr error
+	// heartbeat is closed once the heartbeat function is no longer called, if set
+	heartbeat <-chan struct{}
+	// timeout is the timeout of the run, the lesser of the builder's Timeout
+	// and the time remaining until its Deadline
+	timeout time.Duration
+
+	// stdout and stderr are the configured streams before they were wrapped for the run
+	stdout  io.Writer
+	stderr  io.Writer
+	wrapped bool
+	// stdoutLines and stderrLines call the builder's line functions for the run
+	stdoutLines *lineWriter
+	stderrLines *lineWriter
+	// decoders are the decoders of the captured output to close once the command exits
+	decoders []io.Closer
+	// prefixWriters are the writers of PrefixOutput, holding the incomplete last lines
+	prefixWriters []*prefixWriter
+
+	// path and args are the program and arguments before they were changed for the run
+	path string
+	args []string
+
+	// stdinFile, stdoutFile, and stderrFile are the file streams replaced by the
+	// files opened for the run
+	stdinFile  *fileStream
+	stdoutFile *fileStream
+	stderrFile *fileStream
+	files      []*os.File
+	// stdinData is the data replaced by the reader created for the run
+	stdinData *stdinData
+
+	pty *ptyState
+	// priority holds the command until its niceness is set, see Nice
+	priority *priorityGate
+	// tree tracks the process's children for KillProcessTree, if needed
+	tree *treeState
+
+	// outputErr is set if the captured output exceeded the builder's MaxOutput
+	outputErr *OutputTooLargeError
+}
+
+var (
+	defaultFactoryMu sync.RWMutex
+	defaultFactory   CmdFactory
+)
+
+// SetDefaultFactory sets the factory the package-level Cmd, CmdContext, Shell,
+// and the like create builders with, e.g. to set process-wide defaults once in
+// a small program instead of passing a factory around. The default is the zero
+// CmdFactory, which leaves the builders as they are.
+func SetDefaultFactory(factory CmdFactory) {
+	defaultFactoryMu.Lock()
+	defer defaultFactoryMu.Unlock()
+	defaultFactory = factory
+}
+
+// DefaultFactory returns the factory the package-level constructors create builders with
+func DefaultFactory() CmdFactory {
+	defaultFactoryMu.RLock()
+	defer defaultFactoryMu.RUnlock()
+	return defaultFactory
 }
 
 // Cmd returns the CmdBuilder struct that can be used to build/execute 'exec.Cmd` structs.
+// The builder is created by the DefaultFactory.
 func Cmd(name string, args ...string) *CmdBuilder {
-	cmd := exec.Command(name, args...)
-	cmd.Stderr = os.Stderr
-	cmd.Env = os.Environ()
+	return DefaultFactory().Cmd(name, args...)
+}
+
+// CmdContext is like Cmd but the command is bound to the provided context.
+// The process will be killed if the context is done before the command completes.
+func CmdContext(ctx context.Context, name string, args ...string) *CmdBuilder {
+	return DefaultFactory().CmdContext(ctx, name, args...)
+}
+
+var (
+	commandFuncMu sync.RWMutex
+	// commandFunc creates the exec.Cmd of new builders instead of exec.Command, if set
+	commandFunc func(name string, args ...string) *exec.Cmd
+)
+
+// SetCommandFunc sets the function creating the exec.Cmd of the builders created
+// from then on, by the package-level constructors or any factory, instead of
+// exec.Command, e.g. to sandbox every command or route it to a remote executor.
+// The builder configures the returned command as usual, keeping its Env and
+// Stderr if set. For CmdContext, the returned command is bound to the context the
+// way exec.CommandContext does. A nil fn restores exec.Command.
+func SetCommandFunc(fn func(name string, args ...string) *exec.Cmd) {
+	commandFuncMu.Lock()
+	defer commandFuncMu.Unlock()
+	commandFunc = fn
+}
+
+// command creates the exec.Cmd of a new builder, bound to ctx if it isn't nil,
+// with the function set by SetCommandFunc
+func command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	commandFuncMu.RLock()
+	fn := commandFunc
+	commandFuncMu.RUnlock()
+
+	switch {
+	case fn == nil && ctx == nil:
+		return exec.Command(name, args...)
+	case fn == nil:
+		return exec.CommandContext(ctx, name, args...)
+	case ctx == nil:
+		return fn(name, args...)
+	}
+	// only exec.CommandContext binds a command to a context
+	return copyCmd(ctx, fn(name, args...))
+}
+
+// newCmd returns a builder for the command without any factory options
+func newCmd(name string, args ...string) *CmdBuilder {
+	return newBuilder(nil, command(nil, name, args...))
+}
+
+// newCmdContext is like newCmd but the command is bound to the provided context
+func newCmdContext(ctx context.Context, name string, args ...string) *CmdBuilder {
+	return newBuilder(ctx, command(ctx, name, args...))
+}
+
+// inheritEnv is false if builders start from an empty environment, see SetInheritEnv
+var inheritEnv atomic.Bool
+
+func init() {
+	inheritEnv.Store(true)
+}
+
+// SetInheritEnv sets whether the builders created from then on, by the package-level
+// constructors or any factory, start from the current process's environment, the default.
+// Disabling it starts them from an empty environment, so every variable a command
+// gets must be explicitly set with Env and the like or a factory's options. This keeps
+// secrets in the environment of the current process, e.g. API tokens, from leaking
+// to commands that don't need them, including commands created by code that doesn't
+// go through a configured factory. A factory's InheritEnv option takes precedence.
+func SetInheritEnv(inherit bool) {
+	inheritEnv.Store(inherit)
+}
+
+func newBuilder(ctx context.Context, cmd *exec.Cmd) *CmdBuilder {
+	// a command created by the function set by SetCommandFunc may already be configured
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+	if cmd.Env == nil {
+		cmd.Env = []string{}
+		if inheritEnv.Load() {
+			cmd.Env = os.Environ()
+		}
+	}
 
 	return &CmdBuilder{
-		cmd: cmd,
+		cmd:       cmd,
+		ctx:       ctx,
+		name:      cmd.Args[0],
+		killGrace: DefaultKillGrace,
 	}
 }
 
 // Shell is like Cmd except it passes the arg string to the OS shell.
 //
-// Linux: 'bash -c'
+// Linux: '$SHELL -c', falling back to 'bash -c'
 //
-// macOS: 'zsh -c'
+// macOS: '$SHELL -c', falling back to 'zsh -c'
 //
 // Windows: 'powershell -Command'
 //
 // Everything else: '$SHELL -c'
+//
+// The builder is created by the DefaultFactory, so its Shell option applies.
 func Shell(args string) *CmdBuilder {
+	return DefaultFactory().Shell(args)
+}
+
+// ShellWith is like Shell except it uses the specified shell and flag,
+// e.g. ShellWith("pwsh", "-Command", args)
+func ShellWith(shell string, flag string, args string) *CmdBuilder {
+	return DefaultFactory().ShellWith(shell, flag, args)
+}
+
+// ShellCmdExe is like Shell except it uses 'cmd /c' on Windows, which is faster to
+// start than PowerShell and understands batch syntax. The arg string is passed to
+// cmd verbatim instead of being quoted like a regular argument, since cmd doesn't
+// follow the usual Windows quoting rules. On other systems it's the same as Shell.
+func ShellCmdExe(args string) *CmdBuilder {
+	return DefaultFactory().ShellCmdExe(args)
+}
+
+// shellArgs records the shell running the arg string and passes the arg string
+// verbatim when the shell is cmd.exe
+func (cmdBuilder *CmdBuilder) shellArgs(shell string, flag string, args string) *CmdBuilder {
+	cmdBuilder.shell = strings.TrimSuffix(strings.ToLower(filepath.Base(shell)), ".exe")
+	if cmdBuilder.shell == "cmd" {
+		cmdBuilder.rawCmdLine(flag + " " + args)
+	}
+	return cmdBuilder
+}
+
+// PipeFail enables the pipefail option of the shell running a command created with
+// Shell or ShellWith, so a pipeline in the arg string fails with the exit status of
+// the last command in it that failed instead of the status of its last command.
+// PipeFail does nothing for shells without the option, e.g. fish, PowerShell, and
+// cmd.exe, or for commands that aren't run by a shell. A shell that fails to start
+// returns an error that isn't an *exec.ExitError, so it can be told apart.
+func (cmdBuilder *CmdBuilder) PipeFail() *CmdBuilder {
+	if cmdBuilder.pipeFail {
+		return cmdBuilder
+	}
+
+	var option string
+	switch cmdBuilder.shell {
+	case "bash", "zsh", "ksh", "mksh", "ash", "busybox":
+		option = "set -o pipefail; "
+	case "sh", "dash":
+		// older versions don't support pipefail and exit on the unknown option
+		option = "(set -o pipefail) 2>/dev/null && set -o pipefail; "
+	default:
+		return cmdBuilder
+	}
+
+	args := cmdBuilder.cmd.Args
+	args[len(args)-1] = option + args[len(args)-1]
+	cmdBuilder.pipeFail = true
+	return cmdBuilder
+}
+
+// defaultShell returns the OS shell and the flag used to pass it a command string
+func defaultShell() (string, string) {
 	switch runtime.GOOS {
 	default:
-		return Cmd(os.Getenv("SHELL"), "-c", args)
+		return os.Getenv("SHELL"), "-c"
 	case "linux":
-		return Cmd("bash", "-c", args)
+		if shell := os.Getenv("SHELL"); shell != "" {
+			return shell, "-c"
+		}
+		return "bash", "-c"
 	case "darwin":
-		return Cmd("zsh", "-c", args)
+		if shell := os.Getenv("SHELL"); shell != "" {
+			return shell, "-c"
+		}
+		return "zsh", "-c"
 	case "windows":
-		return Cmd("powershell", "-Command", args)
+		return "powershell", "-Command"
 	}
 }
 
+// Args appends the arguments to the command's existing arguments
+func (cmdBuilder *CmdBuilder) Args(args ...string) *CmdBuilder {
+	cmdBuilder.cmd.Args = append(cmdBuilder.cmd.Args, args...)
+	return cmdBuilder
+}
+
+// SetArgs replaces all of the command's arguments, keeping the program name
+func (cmdBuilder *CmdBuilder) SetArgs(args ...string) *CmdBuilder {
+	cmdBuilder.cmd.Args = append([]string{cmdBuilder.cmd.Args[0]}, args...)
+	return cmdBuilder
+}
+
+// Argv0 sets the name the program sees itself invoked as, argv[0], e.g. "-bash"
+// to start a login shell or the name of a busybox applet. The program that runs
+// is still the one the builder was created with: exec.Cmd.Path is the executable
+// and Args[0] is only passed to it. String and errors show the program, not argv[0].
+// Argv0 isn't applied when the command is wrapped in a shell to set its Umask
+// or resource limits, in which case argv[0] is the program's path.
+func (cmdBuilder *CmdBuilder) Argv0(name string) *CmdBuilder {
+	cmdBuilder.cmd.Args[0] = name
+	return cmdBuilder
+}
+
 // Dir specifies the working directory of the command.
 // If Dir is the empty string, the command will run in the
-// in calling process's current directory.
+// in calling process's current directory. If the directory doesn't exist
+// when the command is started, a *DirError is returned. See MkdirDir.
 func (cmdBuilder *CmdBuilder) Dir(dir string) *CmdBuilder {
 	cmdBuilder.cmd.Dir = dir
 	return cmdBuilder
@@ -148,6 +696,94 @@ func (cmdBuilder *CmdBuilder) Stdin(stdin io.Reader) *CmdBuilder {
 	return cmdBuilder
 }
 
+// StdinString sets the command's stdin to read from the string. Every run,
+// e.g. a retry or a run after Reset, reads the whole string.
+func (cmdBuilder *CmdBuilder) StdinString(s string) *CmdBuilder {
+	return cmdBuilder.Stdin(&stdinData{data: []byte(s)})
+}
+
+// StdinBytes sets the command's stdin to read from the bytes. Every run,
+// e.g. a retry or a run after Reset, reads all of the bytes.
+func (cmdBuilder *CmdBuilder) StdinBytes(b []byte) *CmdBuilder {
+	return cmdBuilder.Stdin(&stdinData{data: b})
+}
+
+// stdinData is the stdin set with StdinString or StdinBytes. Like a fileStream it
+// stands in for the reader in the command's configuration, and is swapped for a
+// fresh reader each time the command is started.
+type stdinData struct {
+	data []byte
+}
+
+// Read fails since the data is only read through the reader the builder creates
+func (data *stdinData) Read(p []byte) (int, error) {
+	return 0, errors.New("stdin not opened by the builder")
+}
+
+// TeeStdout writes the command's stdout to w in addition to the configured
+// writer and any output captured by Output and the like. Multiple calls stack.
+func (cmdBuilder *CmdBuilder) TeeStdout(w io.Writer) *CmdBuilder {
+	cmdBuilder.teeStdout = append(cmdBuilder.teeStdout, w)
+	return cmdBuilder
+}
+
+// TeeStderr writes the command's stderr to w in addition to the configured
+// writer and any output captured by Capture and the like. Multiple calls stack.
+// CombinedOutput and the like merge stderr into stdout, which the TeeStdout
+// writers receive instead.
+func (cmdBuilder *CmdBuilder) TeeStderr(w io.Writer) *CmdBuilder {
+	cmdBuilder.teeStderr = append(cmdBuilder.teeStderr, w)
+	return cmdBuilder
+}
+
+// MergeStderr redirects the command's stderr into its stdout, the equivalent of
+// '2>&1'. The child shares a single live writer for both streams, so anything that
+// captures stdout, e.g. Output, captures stderr as well, and the configured Stderr
+// and TeeStderr writers receive nothing. CombinedOutput and the like do the same
+// for the run.
+func (cmdBuilder *CmdBuilder) MergeStderr() *CmdBuilder {
+	cmdBuilder.mergeStderr = true
+	return cmdBuilder
+}
+
+// PrefixOutput writes the prefix at the start of every line the command writes to
+// its configured stdout and stderr, including any TeeStdout and TeeStderr writers,
+// e.g. to tell apart the output of concurrent commands. Each line is written with its
+// prefix in a single write once it's complete, so the lines of commands sharing a
+// SyncWriter, see SyncStreams, never interleave. An incomplete last line is written
+// once the command exits. Output captured by Output and the like isn't prefixed.
+func (cmdBuilder *CmdBuilder) PrefixOutput(prefix string) *CmdBuilder {
+	cmdBuilder.prefix = prefix
+	return cmdBuilder
+}
+
+// StripANSI removes ANSI escape sequences, e.g. colors, from the output captured
+// by Output, CombinedOutput, and the like, and from the output written to any
+// TeeStdout and TeeStderr writers. The configured Stdout and Stderr are unaffected.
+func (cmdBuilder *CmdBuilder) StripANSI() *CmdBuilder {
+	cmdBuilder.stripANSI = true
+	return cmdBuilder
+}
+
+// MaxOutput limits how many bytes Output, CombinedOutput, and the like capture
+// from each of the command's output streams. Once the limit is exceeded the
+// process is killed and running the command returns an error wrapping an *OutputTooLargeError
+// holding the output captured up to the limit. A limit of 0 disables the limit.
+func (cmdBuilder *CmdBuilder) MaxOutput(n int64) *CmdBuilder {
+	cmdBuilder.maxOutput = n
+	return cmdBuilder
+}
+
+// Tail keeps only the last n lines of the output captured by Output, CombinedOutput,
+// and the like, including the standard error included in their errors, so the
+// output of a command that writes a lot isn't all held in memory. The output
+// written to the configured writers and tees is unaffected. With MaxOutput, the
+// limit applies to the lines kept. A value of 0 keeps every line.
+func (cmdBuilder *CmdBuilder) Tail(n int) *CmdBuilder {
+	cmdBuilder.tail = n
+	return cmdBuilder
+}
+
 // Interactive sets the stdin, stdout, and stderr to the OS's
 // stdin, stdout, and stderr
 func (cmdBuilder *CmdBuilder) Interactive() *CmdBuilder {
@@ -157,6 +793,39 @@ func (cmdBuilder *CmdBuilder) Interactive() *CmdBuilder {
 	return cmdBuilder
 }
 
+// InheritStdin sets the stdin to the OS's stdin, e.g. so the command can prompt
+// for a password on the terminal while its output is captured
+func (cmdBuilder *CmdBuilder) InheritStdin() *CmdBuilder {
+	cmdBuilder.cmd.Stdin = os.Stdin
+	return cmdBuilder
+}
+
+// InheritStdout sets the stdout to the OS's stdout
+func (cmdBuilder *CmdBuilder) InheritStdout() *CmdBuilder {
+	cmdBuilder.cmd.Stdout = os.Stdout
+	return cmdBuilder
+}
+
+// InheritStderr sets the stderr to the OS's stderr
+func (cmdBuilder *CmdBuilder) InheritStderr() *CmdBuilder {
+	cmdBuilder.cmd.Stderr = os.Stderr
+	return cmdBuilder
+}
+
+// InteractiveRaw is like Interactive except the command runs in a pseudo-terminal,
+// see PTY, and the terminal of the current process is put into raw mode while
+// the command runs, so editors and TUIs like vim, htop, or fzf work. Keys like
+// Ctrl-C are passed to the command instead of signaling the current process,
+// and window size changes are propagated to the command. The terminal is restored
+// once the command exits or fails to start, if an OnStart hook or a function the
+// output is written to panics, and when the current process receives SIGINT,
+// SIGTERM, SIGHUP, or SIGQUIT, which is then relayed to the command, like
+// ForwardSignals. If stdin isn't a terminal, it is left as is.
+func (cmdBuilder *CmdBuilder) InteractiveRaw() *CmdBuilder {
+	cmdBuilder.rawTerminal = true
+	return cmdBuilder.Interactive().PTY()
+}
+
 // NonInteractive sets the stdin, stdout, and stderr to nil which effectively
 // sets them to os.DevNull
 func (cmdBuilder *CmdBuilder) NonInteractive() *CmdBuilder {
@@ -166,61 +835,809 @@ func (cmdBuilder *CmdBuilder) NonInteractive() *CmdBuilder {
 	return cmdBuilder
 }
 
-// Env specifies the environment of the process.
-// Each entry is of the form "key=value".
-// If Env is nil, the new process uses the current process's
-// environment.
+// Quiet discards the command's stdout and stderr
+func (cmdBuilder *CmdBuilder) Quiet() *CmdBuilder {
+	return cmdBuilder.DiscardStdout().DiscardStderr()
+}
+
+// DiscardStdout discards the command's stdout
+func (cmdBuilder *CmdBuilder) DiscardStdout() *CmdBuilder {
+	cmdBuilder.cmd.Stdout = io.Discard
+	return cmdBuilder
+}
+
+// DiscardStderr discards the command's stderr
+func (cmdBuilder *CmdBuilder) DiscardStderr() *CmdBuilder {
+	cmdBuilder.cmd.Stderr = io.Discard
+	return cmdBuilder
+}
+
+// Env adds the variables to the environment of the process.
+// Each entry is of the form "key=value". If a key is specified more than once,
+// including keys in the inherited environment and the factory's environment,
+// the last value wins.
 func (cmdBuilder *CmdBuilder) Env(vars ...string) *CmdBuilder {
-	cmdBuilder.cmd.Env = append(cmdBuilder.cmd.Env, vars...)
+	cmdBuilder.cmd.Env = dedupEnv(append(cmdBuilder.cmd.Env, vars...))
+	return cmdBuilder
+}
+
+// ClearEnv removes every variable from the environment of the process, including
+// the inherited environment, so subsequent calls to Env start from an empty environment.
+func (cmdBuilder *CmdBuilder) ClearEnv() *CmdBuilder {
+	cmdBuilder.cmd.Env = []string{}
+	return cmdBuilder
+}
+
+// Timeout sets the maximum amount of time the command is allowed to run.
+// Once the timeout elapses the process is signaled to terminate and, if it is
+// still running after the kill grace period, it is killed. Running the command
+// then returns an error wrapping a *TimeoutError. A timeout of 0 disables the timeout.
+func (cmdBuilder *CmdBuilder) Timeout(d time.Duration) *CmdBuilder {
+	cmdBuilder.timeout = d
+	return cmdBuilder
+}
+
+// AllowExitCodes treats the non-zero exit codes as success, e.g. 1 for diff when
+// the files differ, so running the command doesn't return an error and the output
+// is returned as usual. Other exit codes still fail the command. The real exit code
+// is still reported by Capture. Multiple calls stack.
+func (cmdBuilder *CmdBuilder) AllowExitCodes(codes ...int) *CmdBuilder {
+	cmdBuilder.allowExitCodes = append(cmdBuilder.allowExitCodes, codes...)
+	return cmdBuilder
+}
+
+// allowedExit reports whether the exit code is treated as success
+func (cmdBuilder *CmdBuilder) allowedExit(code int) bool {
+	for _, allowed := range cmdBuilder.allowExitCodes {
+		if code == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// Deadline sets the time by which the command must complete, e.g. a deadline shared
+// by the commands of a job. The time remaining is computed each time the command
+// is run and enforced like Timeout. If Timeout is also set, whichever elapses first
+// applies. If the deadline has already passed the command isn't started and
+// running it returns an error wrapping a *TimeoutError. A zero time disables the deadline.
+func (cmdBuilder *CmdBuilder) Deadline(t time.Time) *CmdBuilder {
+	cmdBuilder.deadline = t
+	return cmdBuilder
+}
+
+// Cancel sets the function called to stop the process when the context the command is
+// bound to is done, instead of killing it, e.g. to let it shut down gracefully.
+// The function should make the process exit; combine with WaitDelay to bound how long
+// waiting on it blocks afterwards. If it returns an error other than os.ErrProcessDone,
+// the process is killed and running the command returns an error wrapping it.
+// Running the command returns an error wrapping the context's error even if the
+// process exits successfully. A timeout still terminates
+// the process as described in Timeout.
+// See exec.Cmd.Cancel.
+func (cmdBuilder *CmdBuilder) Cancel(fn func() error) *CmdBuilder {
+	cmdBuilder.cancel = fn
+	cmdBuilder.cancelSignal = nil
+	return cmdBuilder
+}
+
+// CancelSignal is like Cancel except the process is sent sig, e.g. os.Interrupt,
+// when the context is done, or its process group with KillProcessTree.
+// Sending os.Interrupt isn't supported on Windows.
+func (cmdBuilder *CmdBuilder) CancelSignal(sig os.Signal) *CmdBuilder {
+	cmdBuilder.cancel = nil
+	cmdBuilder.cancelSignal = sig
+	return cmdBuilder
+}
+
+// KillGrace sets how long a timed out command has to exit after being signaled
+// before it is killed. Defaults to DefaultKillGrace. A grace period of 0 kills the
+// process immediately.
+//
+// On Windows the process is always killed immediately.
+func (cmdBuilder *CmdBuilder) KillGrace(d time.Duration) *CmdBuilder {
+	cmdBuilder.killGrace = d
+	return cmdBuilder
+}
+
+// WaitDelay bounds how long waiting on the command blocks on its I/O after the
+// process exits, e.g. because a child the command forked still holds its stdout open.
+// Once the delay elapses the pipes are closed and the wait returns. This makes
+// waiting on a command stopped by its context or Timeout return promptly too, since
+// the delay starts when the context is done or the killed process exits.
+// A delay of 0, the default, waits until the pipes are closed. See exec.Cmd.WaitDelay.
+func (cmdBuilder *CmdBuilder) WaitDelay(d time.Duration) *CmdBuilder {
+	cmdBuilder.cmd.WaitDelay = d
+	return cmdBuilder
+}
+
+// DryRun causes the command line to be written to w instead of executing the command.
+// Run, Start, and Wait return success without spawning a process and the methods
+// that capture output return empty output.
+func (cmdBuilder *CmdBuilder) DryRun(w io.Writer) *CmdBuilder {
+	cmdBuilder.dryRun = w
+	return cmdBuilder
+}
+
+// detachStreams disconnects the default stderr, the current process's stderr,
+// so a detached command doesn't write to it
+func (cmdBuilder *CmdBuilder) detachStreams() {
+	if cmdBuilder.cmd.Stderr == io.Writer(os.Stderr) {
+		cmdBuilder.cmd.Stderr = nil
+	}
+}
+
+// ExtraFiles passes the open files to the process in addition to stdin, stdout, and
+// stderr, e.g. a listening socket. The files appear in the process as file descriptors
+// 3, 4, and so on, in the order they were added. The files aren't closed by the builder.
+// ExtraFiles isn't supported on Windows.
+func (cmdBuilder *CmdBuilder) ExtraFiles(files ...*os.File) *CmdBuilder {
+	cmdBuilder.cmd.ExtraFiles = append(cmdBuilder.cmd.ExtraFiles, files...)
+	return cmdBuilder
+}
+
+// SysProcAttr sets the OS-specific attributes used when starting the process
+func (cmdBuilder *CmdBuilder) SysProcAttr(attr *syscall.SysProcAttr) *CmdBuilder {
+	cmdBuilder.cmd.SysProcAttr = attr
 	return cmdBuilder
 }
 
+// setErr records the first error encountered while configuring the builder
+func (cmdBuilder *CmdBuilder) setErr(err error) {
+	if cmdBuilder.err == nil {
+		cmdBuilder.err = err
+	}
+}
+
+// sysProcAttr returns the command's SysProcAttr, creating it if needed
+func (cmdBuilder *CmdBuilder) sysProcAttr() *syscall.SysProcAttr {
+	if cmdBuilder.cmd.SysProcAttr == nil {
+		cmdBuilder.cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	return cmdBuilder.cmd.SysProcAttr
+}
+
 // Build returns the built *exec.Cmd struct
 func (cmdBuilder *CmdBuilder) Build() *exec.Cmd {
+	cmdBuilder.cmd.Env = dedupEnv(cmdBuilder.cmd.Env)
+	// the built command holds the expanded arguments and the wrapper setting the
+	// umask and resource limits, so they mustn't be applied again
+	cmdBuilder.cmd.Args = cmdBuilder.args()
+	cmdBuilder.wrapCmd()
+	cmdBuilder.expandArgs = false
+	cmdBuilder.umask, cmdBuilder.rlimits = nil, nil
+	if data, ok := cmdBuilder.cmd.Stdin.(*stdinData); ok {
+		cmdBuilder.cmd.Stdin = bytes.NewReader(data.data)
+	}
 	return cmdBuilder.cmd
 }
 
+// context returns the context the builder was created with or context.Background
+func (cmdBuilder *CmdBuilder) context() context.Context {
+	if cmdBuilder.ctx == nil {
+		return context.Background()
+	}
+	return cmdBuilder.ctx
+}
+
 // Start starts the specified command but does not wait for it to complete.
+// Use Wait to wait for the command to exit.
 func (cmdBuilder *CmdBuilder) Start() error {
-	return cmdBuilder.cmd.Start()
+	return cmdBuilder.StartContext(cmdBuilder.context())
 }
 
-// Run starts the specified command and waits for it to complete.
-func (cmdBuilder *CmdBuilder) Run() error {
-	return cmdBuilder.cmd.Run()
+// StartContext is like Start but binds the command to the provided context.
+// The process will be killed if the context is done before the command completes.
+func (cmdBuilder *CmdBuilder) StartContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	for _, stage := range cmdBuilder.stages() {
+		if stage.err != nil {
+			return stage.err
+		}
+	}
+
+	if cmdBuilder.dryRun != nil {
+		for _, stage := range cmdBuilder.stages() {
+			stage.closePipes()
+			stage.releasePipes()
+		}
+		_, err := fmt.Fprintln(cmdBuilder.dryRun, cmdBuilder.String())
+		return err
+	}
+
+	if cmdBuilder.prev != nil {
+		return cmdBuilder.cmdError(cmdBuilder.startPipeline(ctx))
+	}
+	return cmdBuilder.cmdError(cmdBuilder.start(ctx))
 }
 
-// Output runs the command and returns its standard output.
-// Any returned error will usually be of type *ExitError.
-func (cmdBuilder *CmdBuilder) Output() (string, error) {
-	var output []byte
+// start starts the command and watches it using the provided context
+func (cmdBuilder *CmdBuilder) start(ctx context.Context) (err error) {
+	// the started process holds the write ends of the pipes; if it didn't start
+	// the readers see the end of the output
+	defer func() {
+		cmdBuilder.closePipes()
+		if err != nil {
+			cmdBuilder.releasePipes()
+		}
+	}()
+	// a panicking OnStart hook mustn't leave the terminal in raw mode
+	defer func() {
+		if r := recover(); r != nil {
+			cmdBuilder.restorePTY()
+			panic(r)
+		}
+	}()
+	if err := cmdBuilder.checkPipes(); err != nil {
+		return err
+	}
+
+	cmdBuilder.state.duration = 0
+	cmdBuilder.state.outputErr = nil
+	cmdBuilder.state.timeout = cmdBuilder.timeout
+	if !cmdBuilder.deadline.IsZero() {
+		remaining := time.Until(cmdBuilder.deadline)
+		if remaining <= 0 {
+			return &TimeoutError{Deadline: cmdBuilder.deadline, Err: context.DeadlineExceeded}
+		}
+		if cmdBuilder.state.timeout <= 0 || remaining < cmdBuilder.state.timeout {
+			cmdBuilder.state.timeout = remaining
+		}
+	}
+	cmdBuilder.cmd.Env = dedupEnv(cmdBuilder.cmd.Env)
+
+	if err := cmdBuilder.checkDir(); err != nil {
+		return err
+	}
+	if err := cmdBuilder.openFiles(); err != nil {
+		return err
+	}
+	if cmdBuilder.nice != nil {
+		if err := cmdBuilder.openPriorityGate(); err != nil {
+			cmdBuilder.closeFiles()
+			return err
+		}
+	}
+
+	cmdBuilder.expand()
+	cmdBuilder.wrapStreams()
+	if cmdBuilder.pty {
+		if err := cmdBuilder.openPTY(); err != nil {
+			cmdBuilder.restoreStreams(false)
+			cmdBuilder.restoreArgs()
+			cmdBuilder.closePriorityGate()
+			cmdBuilder.closeFiles()
+			return err
+		}
+	}
+
+	if cmdBuilder.killTree {
+		cmdBuilder.startProcessTree()
+	}
+	// watch stops the process when either context is done, so exec, which only calls
+	// Cancel for commands created with a context, must not kill it on its own
+	if cmdBuilder.ctx != nil {
+		cmdBuilder.cmd.Cancel = func() error {
+			return nil
+		}
+	}
+	if err := cmdBuilder.cmd.Start(); err != nil {
+		cmdBuilder.closeProcessTree()
+		cmdBuilder.closePTY(false)
+		cmdBuilder.restoreStreams(false)
+		cmdBuilder.restoreArgs()
+		cmdBuilder.closePriorityGate()
+		cmdBuilder.closeFiles()
+		return err
+	}
+	// the shell running the command exits once the gate is closed without being
+	// let through, and its output, if any, is discarded
+	if cmdBuilder.nice != nil {
+		if err := cmdBuilder.setPriority(); err != nil {
+			cmdBuilder.cmd.Wait()
+			cmdBuilder.closeProcessTree()
+			cmdBuilder.closePTY(false)
+			cmdBuilder.restoreStreams(false)
+			cmdBuilder.restoreArgs()
+			cmdBuilder.closeFiles()
+			return err
+		}
+	}
+
+	if cmdBuilder.pty {
+		cmdBuilder.attachPTY()
+	}
+	if cmdBuilder.killTree {
+		cmdBuilder.attachProcessTree()
+	}
+
+	cmdBuilder.state.ctx = ctx
+	cmdBuilder.state.started = time.Now()
+	cmdBuilder.state.done = make(chan struct{})
+	cmdBuilder.state.timedOut = make(chan bool, 1)
+	cmdBuilder.state.canceled = nil
+	cmdBuilder.state.cancelErr = nil
+	go cmdBuilder.watch(ctx, cmdBuilder.state.done, cmdBuilder.state.timedOut)
+	if len(cmdBuilder.forwardSignals) > 0 {
+		cmdBuilder.forward(cmdBuilder.state.done)
+	}
+	cmdBuilder.state.heartbeat = nil
+	if cmdBuilder.heartbeat != nil && cmdBuilder.heartbeatInterval > 0 {
+		cmdBuilder.state.heartbeat = cmdBuilder.beat(cmdBuilder.state.done)
+	}
+
+	for _, fn := range cmdBuilder.onStart {
+		fn(cmdBuilder.cmd)
+	}
+	return nil
+}
+
+// watch kills the process if the context of the run, or the one the builder was
+// created with, is done or the timeout elapses before the command exits.
+// Whether the command timed out is sent on timedOut.
+func (cmdBuilder *CmdBuilder) watch(ctx context.Context, done chan struct{}, timedOut chan bool) {
+	var timeout <-chan time.Time
+	if cmdBuilder.state.timeout > 0 {
+		timer := time.NewTimer(cmdBuilder.state.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	// a builder created with a context may be run with another one
+	var bound <-chan struct{}
+	if cmdBuilder.ctx != nil && cmdBuilder.ctx != ctx {
+		bound = cmdBuilder.ctx.Done()
+	}
+
+	select {
+	case <-ctx.Done():
+		cmdBuilder.stop(ctx)
+	case <-bound:
+		cmdBuilder.stop(cmdBuilder.ctx)
+	case <-timeout:
+		timedOut <- true
+		terminate(cmdBuilder.target(), cmdBuilder.killGrace, done)
+		return
+	case <-done:
+	}
+	timedOut <- false
+}
+
+// stop stops the process because ctx is done
+func (cmdBuilder *CmdBuilder) stop(ctx context.Context) {
+	cmdBuilder.state.canceled = ctx
+
 	var err error
+	switch {
+	case cmdBuilder.cancel != nil:
+		err = cmdBuilder.cancel()
+	case cmdBuilder.cancelSignal != nil:
+		err = cmdBuilder.target().Signal(cmdBuilder.cancelSignal)
+	default:
+		cmdBuilder.target().Kill()
+		return
+	}
 
-	// if cmd.Stdout is already specified then Output() errors out with "exec: Stdout already set"
-	if cmdBuilder.cmd.Stdout != nil {
-		var outBuf bytes.Buffer
-		cmdBuilder.cmd.Stdout = io.MultiWriter(cmdBuilder.cmd.Stdout, &outBuf)
-		err = cmdBuilder.cmd.Run()
-		if err != nil {
-			return "", err
+	// like exec.Cmd.Cancel, a process that's already done isn't an error
+	if err != nil && !errors.Is(err, os.ErrProcessDone) {
+		cmdBuilder.state.cancelErr = err
+		cmdBuilder.target().Kill()
+	}
+}
+
+// Wait waits for a command started with Start or StartContext to exit.
+// If the command fails the returned error is a *CmdError describing the command.
+// If the context the command is bound to was done before the command completed
+// the error wraps the context's error. If the command timed out the error wraps
+// a *TimeoutError. If the command is the last stage of a pipeline, Wait waits for
+// every stage and returns a *PipelineError holding a *CmdError for each failed stage.
+func (cmdBuilder *CmdBuilder) Wait() error {
+	if cmdBuilder.dryRun != nil {
+		return nil
+	}
+
+	if cmdBuilder.prev != nil {
+		return cmdBuilder.waitPipeline()
+	}
+	return cmdBuilder.cmdError(cmdBuilder.wait())
+}
+
+// wait waits for the command to exit
+func (cmdBuilder *CmdBuilder) wait() error {
+	cmdBuilder.awaitPipes()
+	err := cmdBuilder.cmd.Wait()
+	cmdBuilder.state.duration = time.Since(cmdBuilder.state.started)
+	cmdBuilder.closePTY(true)
+	cmdBuilder.restoreStreams(true)
+	cmdBuilder.restoreArgs()
+	cmdBuilder.closeFiles()
+	cmdBuilder.releasePipes()
+
+	err = cmdBuilder.stopWatching(err)
+	// the process tree may be killed until the command is no longer watched
+	cmdBuilder.closeProcessTree()
+	if exitErr, ok := err.(*exec.ExitError); ok && cmdBuilder.allowedExit(exitErr.ExitCode()) {
+		err = nil
+	}
+	if err != nil && len(cmdBuilder.rlimits) > 0 {
+		err = cmdBuilder.limitError(err)
+	}
+	if cmdBuilder.state.outputErr != nil {
+		err = cmdBuilder.state.outputErr
+	}
+	for _, fn := range cmdBuilder.onExit {
+		fn(cmdBuilder.cmd, err)
+	}
+	for _, fn := range cmdBuilder.onComplete {
+		fn(cmdBuilder.state.duration, err)
+	}
+	return err
+}
+
+// stopWatching stops watching the exited command and returns the error from
+// waiting on it, accounting for timeouts and the context being done
+func (cmdBuilder *CmdBuilder) stopWatching(err error) error {
+	if cmdBuilder.state.done != nil {
+		close(cmdBuilder.state.done)
+		cmdBuilder.state.done = nil
+		if cmdBuilder.state.heartbeat != nil {
+			<-cmdBuilder.state.heartbeat
 		}
-		output = outBuf.Bytes()
-	} else {
-		output, err = cmdBuilder.cmd.Output()
-		if err != nil {
-			return "", err
+
+		if <-cmdBuilder.state.timedOut {
+			timeoutErr := &TimeoutError{
+				Timeout:  cmdBuilder.state.timeout,
+				Duration: cmdBuilder.state.duration,
+				Err:      err,
+			}
+			if cmdBuilder.state.timeout != cmdBuilder.timeout {
+				timeoutErr.Deadline = cmdBuilder.deadline
+			}
+			return timeoutErr
+		}
+
+		if canceled := cmdBuilder.state.canceled; canceled != nil {
+			cause := canceled.Err()
+			if cmdBuilder.state.cancelErr != nil {
+				cause = fmt.Errorf("%w: cancel: %w", cause, cmdBuilder.state.cancelErr)
+			}
+			// a process stopped by Cancel may exit successfully
+			if err == nil || errors.Is(err, canceled.Err()) {
+				return cause
+			}
+			return fmt.Errorf("%w: %v", cause, err)
+		}
+	}
+
+	if err != nil && cmdBuilder.state.ctx != nil && cmdBuilder.state.ctx.Err() != nil {
+		if errors.Is(err, cmdBuilder.state.ctx.Err()) {
+			return err
 		}
+		return fmt.Errorf("%w: %v", cmdBuilder.state.ctx.Err(), err)
+	}
+	return err
+}
+
+// Pid returns the process id of the process started by Start or the last run,
+// or -1 if no process has been spawned. For a pipeline, the process id of the
+// last stage is returned.
+func (cmdBuilder *CmdBuilder) Pid() int {
+	if cmdBuilder.cmd.Process == nil {
+		return -1
+	}
+	return cmdBuilder.cmd.Process.Pid
+}
+
+// LastDuration returns the wall-clock duration of the last run of the command,
+// measured from when the process started until it exited
+func (cmdBuilder *CmdBuilder) LastDuration() time.Duration {
+	return cmdBuilder.state.duration
+}
+
+// ProcessState returns the state of the process of the last run once it has been
+// waited on, e.g. its CPU time or, through Sys, whether it was killed by a signal,
+// or nil if no process has exited yet. For a pipeline, the state of the last stage
+// is returned. Reset clears it.
+func (cmdBuilder *CmdBuilder) ProcessState() *os.ProcessState {
+	return cmdBuilder.cmd.ProcessState
+}
+
+// Run starts the specified command and waits for it to complete.
+func (cmdBuilder *CmdBuilder) Run() error {
+	return cmdBuilder.RunContext(cmdBuilder.context())
+}
+
+// RunContext is like Run but binds the command to the provided context.
+func (cmdBuilder *CmdBuilder) RunContext(ctx context.Context) error {
+	err := cmdBuilder.run(ctx, nil)
+	return cmdBuilder.runChain(ctx, err)
+}
+
+// Success runs the command with its stdout and stderr discarded and reports whether
+// it succeeded. The configured streams are restored afterwards, so later runs write
+// to them as usual. A command that exits with a non-zero status or fails to start,
+// e.g. because the program doesn't exist, isn't successful.
+func (cmdBuilder *CmdBuilder) Success() bool {
+	stdout, stderr := cmdBuilder.cmd.Stdout, cmdBuilder.cmd.Stderr
+	defer func() {
+		cmdBuilder.cmd.Stdout, cmdBuilder.cmd.Stderr = stdout, stderr
+	}()
+	return cmdBuilder.Quiet().Run() == nil
+}
+
+// runOnce starts the command and waits for it to complete
+func (cmdBuilder *CmdBuilder) runOnce(ctx context.Context) error {
+	if err := cmdBuilder.StartContext(ctx); err != nil {
+		return err
+	}
+	return cmdBuilder.Wait()
+}
+
+// Output runs the command and returns its trimmed standard output, see TrimSpace.
+// Standard error is captured as well, so that if the command exits with a non-zero
+// status the returned error wraps an *ExitError including the captured standard error.
+// The output is captured in addition to being written to the configured Stdout,
+// Stderr, and tees, so configuring them never keeps Output, Lines, CombinedOutput,
+// or Capture from returning the output. Only StdoutPipe and StderrPipe conflict with
+// capturing it, see ErrPipeConflict.
+func (cmdBuilder *CmdBuilder) Output() (string, error) {
+	return cmdBuilder.OutputContext(cmdBuilder.context())
+}
+
+// OutputContext is like Output but binds the command to the provided context.
+func (cmdBuilder *CmdBuilder) OutputContext(ctx context.Context) (string, error) {
+	output, err := cmdBuilder.outputBytes(ctx)
+	if err != nil {
+		return "", err
 	}
 
-	return strings.TrimSpace(string(output)), nil
+	return cmdBuilder.trim(string(output)), nil
 }
 
-// Lines is like Output except it will split by new lines
+// TrimSpace sets whether the output returned by Output, CombinedOutput,
+// OutputAndError, and Capture is trimmed. When it is, the default, all leading
+// and trailing white space, as defined by Unicode, is removed, including every
+// trailing new line. Otherwise the output is returned verbatim.
+func (cmdBuilder *CmdBuilder) TrimSpace(trim bool) *CmdBuilder {
+	cmdBuilder.rawOutput = !trim
+	cmdBuilder.trimCutset = nil
+	return cmdBuilder
+}
+
+// TrimCutset trims the output returned by Output, CombinedOutput, OutputAndError,
+// and Capture with strings.Trim, removing all leading and trailing characters
+// contained in cutset, instead of white space, e.g. " \t\n\x00".
+func (cmdBuilder *CmdBuilder) TrimCutset(cutset string) *CmdBuilder {
+	cmdBuilder.rawOutput = false
+	cmdBuilder.trimCutset = &cutset
+	return cmdBuilder
+}
+
+// RawOutput returns the output of Output, CombinedOutput, OutputAndError,
+// and Capture verbatim instead of trimmed. It's the same as TrimSpace(false).
+func (cmdBuilder *CmdBuilder) RawOutput() *CmdBuilder {
+	return cmdBuilder.TrimSpace(false)
+}
+
+// trim trims the output unless RawOutput was set
+func (cmdBuilder *CmdBuilder) trim(output string) string {
+	if cmdBuilder.rawOutput {
+		return output
+	}
+	if cmdBuilder.trimCutset != nil {
+		return strings.Trim(output, *cmdBuilder.trimCutset)
+	}
+	return strings.TrimSpace(output)
+}
+
+// OutputBytes is like Output except it returns the raw standard output
+// without trimming it, so it's safe for binary output
+func (cmdBuilder *CmdBuilder) OutputBytes() ([]byte, error) {
+	return cmdBuilder.outputBytes(cmdBuilder.context())
+}
+
+// outputBytes runs the command and returns its raw standard output
+func (cmdBuilder *CmdBuilder) outputBytes(ctx context.Context) ([]byte, error) {
+	var outBuf, errBuf bytes.Buffer
+	limiter := cmdBuilder.limiter()
+	err := cmdBuilder.capture(limiter.limit(&outBuf), limiter.limit(&errBuf), func() error {
+		return cmdBuilder.run(ctx, func() {
+			outBuf.Reset()
+			errBuf.Reset()
+		})
+	})
+	if err != nil {
+		return nil, withStderr(err, errBuf.String())
+	}
+
+	return outBuf.Bytes(), nil
+}
+
+// Lines is like Output except it will split by new lines, see KeepCRLF. The output
+// is always trimmed before it's split, regardless of TrimSpace. Empty output
+// returns an empty slice.
 func (cmdBuilder *CmdBuilder) Lines() ([]string, error) {
-	output, err := cmdBuilder.Output()
+	output, err := cmdBuilder.OutputBytes()
 	if err != nil {
 		return nil, err
 	}
 
-	return strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n"), nil
+	return cmdBuilder.lines(strings.TrimSpace(string(output))), nil
+}
+
+// CombinedOutput runs the command and returns its combined standard output and
+// standard error, in the order they were written. To keep the order the command
+// writes both to a single pipe, as with MergeStderr, so if Stdout is already
+// specified the combined output is written to it as well and Stderr receives nothing.
+func (cmdBuilder *CmdBuilder) CombinedOutput() (string, error) {
+	output, err := cmdBuilder.CombinedOutputBytes()
+	if err != nil {
+		return "", err
+	}
+
+	return cmdBuilder.trim(string(output)), nil
+}
+
+// CombinedOutputBytes is like CombinedOutput except it returns the raw combined
+// output without trimming it, so it's safe for binary output
+func (cmdBuilder *CmdBuilder) CombinedOutputBytes() ([]byte, error) {
+	var outBuf bytes.Buffer
+	buf := NewSyncWriter(cmdBuilder.limiter().limit(&outBuf))
+	err := cmdBuilder.capture(buf, buf, func() error {
+		return cmdBuilder.run(cmdBuilder.context(), outBuf.Reset)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return outBuf.Bytes(), nil
+}
+
+// CombinedLines is like CombinedOutput except it will split by new lines. The
+// output is always trimmed before it's split, regardless of TrimSpace. Empty output
+// returns an empty slice.
+func (cmdBuilder *CmdBuilder) CombinedLines() ([]string, error) {
+	output, err := cmdBuilder.CombinedOutputBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	return cmdBuilder.lines(strings.TrimSpace(string(output))), nil
+}
+
+// OutputAndError runs the command once and returns its trimmed standard output
+// and standard error separately, along with the error running it, e.g. to parse
+// the output while surfacing warnings written to stderr. Unlike Output, the
+// output is returned even if the command fails. If Stdout or Stderr are already
+// specified the output is written to them as well.
+func (cmdBuilder *CmdBuilder) OutputAndError() (stdout string, stderr string, err error) {
+	result := cmdBuilder.captureContext(cmdBuilder.context())
+	return result.Stdout, result.Stderr, result.Err
+}
+
+// ExitCode runs the command and returns its exit status, following the shell's
+// conventions: a command killed by a signal has the status 128 plus the signal's
+// number. The returned error is only non-nil if the command couldn't be run to
+// completion, e.g. it wasn't found or it timed out. If it didn't start the status is -1.
+func (cmdBuilder *CmdBuilder) ExitCode() (int, error) {
+	err := cmdBuilder.Run()
+	if isExitError(err) {
+		err = nil
+	}
+
+	if cmdBuilder.dryRun != nil || cmdBuilder.cmd.ProcessState == nil {
+		if err == nil {
+			return 0, nil
+		}
+		return -1, err
+	}
+
+	if sig, ok := signaled(cmdBuilder.cmd.ProcessState); ok {
+		return 128 + sig, err
+	}
+	return cmdBuilder.cmd.ProcessState.ExitCode(), err
+}
+
+// RunAndExit runs the command and exits the current process with the command's
+// exit status, e.g. in a wrapper whose job is to run another command. See ExitCode.
+// If the command couldn't be started, the error is written to os.Stderr and
+// the status is 127 if the program wasn't found, otherwise 126, like the shell.
+func (cmdBuilder *CmdBuilder) RunAndExit() {
+	code, err := cmdBuilder.ExitCode()
+	if code < 0 {
+		fmt.Fprintln(os.Stderr, err)
+		code = 126
+		if errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+			code = 127
+		}
+	}
+	os.Exit(code)
+}
+
+// RunResult is the result of running a command with Capture
+type RunResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	Duration time.Duration
+
+	// Err is the error the command failed with, including a non-zero exit,
+	// which Capture reports through ExitCode instead of its returned error
+	Err error
+}
+
+// Capture runs the command and returns its trimmed standard output and standard error,
+// exit code, and how long it ran. A non-zero exit is reported through ExitCode
+// rather than the returned error, which is only non-nil if the command could not
+// be run to completion, e.g. the executable was not found. In that case ExitCode is -1.
+// If Stdout or Stderr are already specified the output is written to them as well.
+func (cmdBuilder *CmdBuilder) Capture() (RunResult, error) {
+	result := cmdBuilder.captureContext(cmdBuilder.context())
+	if isExitError(result.Err) {
+		return result, nil
+	}
+	return result, result.Err
+}
+
+// captureContext runs the command bound to ctx and returns its result
+func (cmdBuilder *CmdBuilder) captureContext(ctx context.Context) RunResult {
+	var outBuf, errBuf bytes.Buffer
+	limiter := cmdBuilder.limiter()
+	err := cmdBuilder.capture(limiter.limit(&outBuf), limiter.limit(&errBuf), func() error {
+		return cmdBuilder.run(ctx, func() {
+			outBuf.Reset()
+			errBuf.Reset()
+		})
+	})
+
+	result := RunResult{
+		Stdout:   cmdBuilder.trim(outBuf.String()),
+		Stderr:   cmdBuilder.trim(errBuf.String()),
+		Duration: cmdBuilder.state.duration,
+		Err:      err,
+	}
+	if cmdBuilder.cmd.ProcessState != nil {
+		result.ExitCode = cmdBuilder.cmd.ProcessState.ExitCode()
+	} else if err != nil {
+		result.ExitCode = -1
+	}
+
+	return result
+}
+
+// lines splits the output into lines, or into the tokens of the builder's split function
+func (cmdBuilder *CmdBuilder) lines(output string) []string {
+	if output == "" {
+		return []string{}
+	}
+	if cmdBuilder.split == nil {
+		return splitLines(output, cmdBuilder.keepCRLF)
+	}
+
+	tokens := []string{}
+	scanTokens(strings.NewReader(output), cmdBuilder.split, func(token string) {
+		tokens = append(tokens, token)
+	})
+	return tokens
+}
+
+// splitLines splits the output by "\r\n", "\n", and "\r" line endings,
+// or only by "\n" if keepCRLF is true, leaving any '\r' before it in the line
+func splitLines(output string, keepCRLF bool) []string {
+	if !keepCRLF {
+		output = strings.ReplaceAll(output, "\r\n", "\n")
+		output = strings.ReplaceAll(output, "\r", "\n")
+	}
+	return strings.Split(output, "\n")
+}
+
+// KeepCRLF splits the output returned by Lines and CombinedLines only by "\n",
+// so the lines of output with "\r\n" line endings keep the '\r' and a bare '\r'
+// doesn't end a line. By default the output is split by "\r\n", "\n", and "\r".
+func (cmdBuilder *CmdBuilder) KeepCRLF() *CmdBuilder {
+	cmdBuilder.keepCRLF = true
+	return cmdBuilder
 }
@@ -0,0 +1,51 @@
+//go:build unix
+
+package builder
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestSuccessRestoresStreams(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	cmd := Cmd("sh", "-c", "echo out; echo err >&2").Stdout(&stdout).Stderr(&stderr)
+
+	if !cmd.Success() {
+		t.Fatal("Success() = false, want true")
+	}
+	if stdout.Len() > 0 || stderr.Len() > 0 {
+		t.Fatalf("Success() wrote %q and %q, want the output discarded", stdout.String(), stderr.String())
+	}
+
+	if err := cmd.Reset().Run(); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "out\n" || stderr.String() != "err\n" {
+		t.Errorf("Run() after Success() wrote %q and %q, want %q and %q", stdout.String(), stderr.String(), "out\n", "err\n")
+	}
+}
+
+func TestLinesEmpty(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  func() *CmdBuilder
+	}{
+		{name: "empty output", cmd: func() *CmdBuilder { return Cmd("true") }},
+		{name: "dry run", cmd: func() *CmdBuilder { return Cmd("echo", "line").DryRun(io.Discard) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, err := tt.cmd().Lines()
+			if err != nil || lines == nil || len(lines) != 0 {
+				t.Errorf("Lines() = %#v, %v, want an empty slice", lines, err)
+			}
+			lines, err = tt.cmd().CombinedLines()
+			if err != nil || lines == nil || len(lines) != 0 {
+				t.Errorf("CombinedLines() = %#v, %v, want an empty slice", lines, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// DirError is returned when the command is started if its working directory
+// doesn't exist or isn't a directory
+type DirError struct {
+	Dir string
+	Err error
+}
+
+func (e *DirError) Error() string {
+	switch {
+	case errors.Is(e.Err, fs.ErrNotExist):
+		return fmt.Sprintf("working directory %s does not exist", e.Dir)
+	case errors.Is(e.Err, syscall.ENOTDIR):
+		return fmt.Sprintf("working directory %s is not a directory", e.Dir)
+	}
+	return fmt.Sprintf("working directory %s: %v", e.Dir, e.Err)
+}
+
+func (e *DirError) Unwrap() error {
+	return e.Err
+}
+
+// MkdirDir creates the working directory set with Dir, along with any missing
+// parents, before the command is started
+func (cmdBuilder *CmdBuilder) MkdirDir() *CmdBuilder {
+	cmdBuilder.mkdirDir = true
+	return cmdBuilder
+}
+
+// checkDir checks that the working directory of the command is a directory,
+// creating it first if MkdirDir was set
+func (cmdBuilder *CmdBuilder) checkDir() error {
+	dir := cmdBuilder.cmd.Dir
+	if dir == "" {
+		return nil
+	}
+	if root := cmdBuilder.root(); root != "" {
+		dir = filepath.Join(root, dir)
+	}
+
+	if cmdBuilder.mkdirDir {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return &DirError{Dir: cmdBuilder.cmd.Dir, Err: err}
+		}
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return &DirError{Dir: cmdBuilder.cmd.Dir, Err: err}
+	}
+	if !info.IsDir() {
+		return &DirError{Dir: cmdBuilder.cmd.Dir, Err: syscall.ENOTDIR}
+	}
+	return nil
+}
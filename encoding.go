@@ -0,0 +1,44 @@
+package builder
+
+import "io"
+
+// Encoding decodes the output returned by Output and the like, read through
+// CombinedReader, and passed to line functions, e.g. StreamStderr, writing the
+// decoded output to the writer decode returns. decode is called on each run for
+// each stream, and the writer it returns is closed once the command exits if it is
+// an io.Closer, so any buffered output is flushed. To decode the UTF-16 output of
+// Windows PowerShell with golang.org/x/text:
+//
+//	Encoding(func(w io.Writer) io.Writer {
+//		return transform.NewWriter(w, unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewDecoder())
+//	})
+//
+// By default the output is passed through as it is, which assumes it's UTF-8.
+// The configured Stdout, Stderr, and tees receive the output undecoded.
+func (cmdBuilder *CmdBuilder) Encoding(decode func(w io.Writer) io.Writer) *CmdBuilder {
+	cmdBuilder.decode = decode
+	return cmdBuilder
+}
+
+// decoder wraps a capture writer with the builder's Encoding, if any
+func (cmdBuilder *CmdBuilder) decoder(w io.Writer) io.Writer {
+	if cmdBuilder.decode == nil {
+		return w
+	}
+
+	decoder := cmdBuilder.decode(w)
+	if closer, ok := decoder.(io.Closer); ok {
+		cmdBuilder.state.decoders = append(cmdBuilder.state.decoders, closer)
+	}
+	return decoder
+}
+
+// closeDecoders closes the decoders of the run, flushing what they buffered if the command ran
+func (cmdBuilder *CmdBuilder) closeDecoders(ran bool) {
+	if ran {
+		for _, decoder := range cmdBuilder.state.decoders {
+			decoder.Close()
+		}
+	}
+	cmdBuilder.state.decoders = nil
+}
@@ -0,0 +1,173 @@
+package builder
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// EnvMap adds the variables in m to the environment of the process.
+// A variable replaces any entry already in the environment with the same key.
+func (cmdBuilder *CmdBuilder) EnvMap(m map[string]string) *CmdBuilder {
+	cmdBuilder.cmd.Env = setEnvMap(cmdBuilder.cmd.Env, m)
+	return cmdBuilder
+}
+
+// PrependPath adds the directories to the start of the PATH the command runs with,
+// the inherited PATH or the one set with Env, so they are searched first.
+// Directories already in the PATH are moved rather than repeated. The PATH is used
+// by the command to find the programs it runs; the command's own executable is
+// resolved with the current process's PATH when the builder is created.
+func (cmdBuilder *CmdBuilder) PrependPath(dirs ...string) *CmdBuilder {
+	return cmdBuilder.setPath(dirs, true)
+}
+
+// AppendPath adds the directories to the end of the PATH the command runs with,
+// the inherited PATH or the one set with Env, so they are searched last.
+// Directories already in the PATH are moved rather than repeated. See PrependPath.
+func (cmdBuilder *CmdBuilder) AppendPath(dirs ...string) *CmdBuilder {
+	return cmdBuilder.setPath(dirs, false)
+}
+
+// setPath adds the directories to the start or end of the command's PATH
+func (cmdBuilder *CmdBuilder) setPath(dirs []string, prepend bool) *CmdBuilder {
+	env := cmdBuilder.EnvVars()
+
+	// keep the spelling of the key already in the environment, e.g. "Path" on Windows
+	key := "PATH"
+	for _, entry := range env {
+		if k, ok := envKey(entry); ok && envKeyEqual(k, key) {
+			key = k
+		}
+	}
+	current, _ := getEnv(env, key)
+
+	added := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		added[dir] = true
+	}
+
+	var kept []string
+	for _, dir := range filepath.SplitList(current) {
+		if dir != "" && !added[dir] {
+			kept = append(kept, dir)
+		}
+	}
+
+	var path []string
+	if prepend {
+		path = append(append(path, dirs...), kept...)
+	} else {
+		path = append(append(path, kept...), dirs...)
+	}
+
+	cmdBuilder.cmd.Env = setEnv(env, key, strings.Join(path, string(os.PathListSeparator)))
+	return cmdBuilder
+}
+
+// GetEnv returns the value of the variable in the environment the command will
+// run with, after the inherited, factory, and builder variables are layered
+func (cmdBuilder *CmdBuilder) GetEnv(key string) (string, bool) {
+	return getEnv(cmdBuilder.EnvVars(), key)
+}
+
+// EnvVars returns the environment the command will run with, after the inherited,
+// factory, and builder variables are layered. Each entry is of the form "key=value".
+// Modifying the returned slice doesn't affect the command.
+func (cmdBuilder *CmdBuilder) EnvVars() []string {
+	env := cmdBuilder.cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	return dedupEnv(env)
+}
+
+// setEnvMap sets each variable in m on env in sorted key order
+// so the resulting environment is deterministic
+func setEnvMap(env []string, m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		env = setEnv(env, key, m[key])
+	}
+	return env
+}
+
+// setEnv removes every entry for key from env and appends "key=value"
+func setEnv(env []string, key, value string) []string {
+	result := env[:0:0]
+	for _, entry := range env {
+		if k, ok := envKey(entry); ok && envKeyEqual(k, key) {
+			continue
+		}
+		result = append(result, entry)
+	}
+
+	return append(result, key+"="+value)
+}
+
+// envKey returns the text before the first '=' of the entry. A leading '=' is
+// part of the key, as in the "=C:=C:\\" entries of the environment on Windows.
+func envKey(entry string) (string, bool) {
+	if entry == "" {
+		return "", false
+	}
+
+	i := strings.Index(entry[1:], "=")
+	if i < 0 {
+		return "", false
+	}
+	return entry[:i+1], true
+}
+
+// envKeyEqual reports whether the keys are the same variable.
+// Keys are case insensitive on Windows.
+func envKeyEqual(a, b string) bool {
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// dedupEnv removes duplicate keys from env keeping the last occurrence of
+// each key, which is how the shell resolves them. Entries without '=' are left untouched.
+func dedupEnv(env []string) []string {
+	seen := make(map[string]bool, len(env))
+	result := make([]string, len(env))
+
+	i := len(env)
+	for j := len(env) - 1; j >= 0; j-- {
+		entry := env[j]
+		if key, ok := envKey(entry); ok {
+			if runtime.GOOS == "windows" {
+				key = strings.ToUpper(key)
+			}
+
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+
+		i--
+		result[i] = entry
+	}
+
+	return result[i:]
+}
+
+// getEnv returns the value of the last entry for key in env
+func getEnv(env []string, key string) (string, bool) {
+	for i := len(env) - 1; i >= 0; i-- {
+		if k, ok := envKey(env[i]); ok && envKeyEqual(k, key) {
+			return env[i][len(k)+1:], true
+		}
+	}
+	return "", false
+}
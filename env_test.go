@@ -0,0 +1,130 @@
+package builder
+
+import (
+	"testing"
+)
+
+func TestEnvPrecedence(t *testing.T) {
+	t.Setenv("BUILDER_TEST_INHERITED", "inherited")
+	t.Setenv("BUILDER_TEST_SHARED", "inherited")
+
+	tests := []struct {
+		name    string
+		factory []string
+		cmd     []string
+		key     string
+		want    string
+		wantOK  bool
+	}{
+		{
+			name:   "inherited",
+			key:    "BUILDER_TEST_INHERITED",
+			want:   "inherited",
+			wantOK: true,
+		},
+		{
+			name:    "factory overrides inherited",
+			factory: []string{"BUILDER_TEST_SHARED=factory"},
+			key:     "BUILDER_TEST_SHARED",
+			want:    "factory",
+			wantOK:  true,
+		},
+		{
+			name:    "command overrides factory",
+			factory: []string{"BUILDER_TEST_SHARED=factory"},
+			cmd:     []string{"BUILDER_TEST_SHARED=command"},
+			key:     "BUILDER_TEST_SHARED",
+			want:    "command",
+			wantOK:  true,
+		},
+		{
+			name:   "command overrides inherited",
+			cmd:    []string{"BUILDER_TEST_INHERITED=command"},
+			key:    "BUILDER_TEST_INHERITED",
+			want:   "command",
+			wantOK: true,
+		},
+		{
+			name:   "last command value wins",
+			cmd:    []string{"BUILDER_TEST_SHARED=first", "BUILDER_TEST_SHARED=second"},
+			key:    "BUILDER_TEST_SHARED",
+			want:   "second",
+			wantOK: true,
+		},
+		{
+			name:    "factory keeps other inherited variables",
+			factory: []string{"BUILDER_TEST_SHARED=factory"},
+			key:     "BUILDER_TEST_INHERITED",
+			want:    "inherited",
+			wantOK:  true,
+		},
+		{
+			name:    "unset in every layer",
+			factory: []string{"BUILDER_TEST_SHARED=factory"},
+			cmd:     []string{"BUILDER_TEST_OTHER=command"},
+			key:     "BUILDER_TEST_UNSET",
+			wantOK:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			factory := NewFactory(CmdFactoryOptions{Env: tt.factory})
+			got, ok := factory.Cmd("true").Env(tt.cmd...).GetEnv(tt.key)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("GetEnv(%q) = %q, %v, want %q, %v", tt.key, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestClearEnv(t *testing.T) {
+	t.Setenv("BUILDER_TEST_INHERITED", "inherited")
+
+	factory := NewFactory(CmdFactoryOptions{Env: []string{"BUILDER_TEST_FACTORY=factory"}})
+	cmd := factory.Cmd("true").Env("BUILDER_TEST_CMD=before").ClearEnv().Env("BUILDER_TEST_CMD=after")
+
+	got := cmd.EnvVars()
+	if len(got) != 1 || got[0] != "BUILDER_TEST_CMD=after" {
+		t.Errorf("EnvVars() = %q, want %q", got, []string{"BUILDER_TEST_CMD=after"})
+	}
+}
+
+func TestInheritEnv(t *testing.T) {
+	t.Setenv("BUILDER_TEST_INHERITED", "inherited")
+	t.Cleanup(func() {
+		SetInheritEnv(true)
+	})
+
+	yes, no := true, false
+	tests := []struct {
+		name    string
+		global  bool
+		inherit *bool
+		wantOK  bool
+	}{
+		{name: "default", global: true, wantOK: true},
+		{name: "disabled globally", global: false, wantOK: false},
+		{name: "factory disables", global: true, inherit: &no, wantOK: false},
+		{name: "factory enables", global: false, inherit: &yes, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetInheritEnv(tt.global)
+
+			factory := NewFactory(CmdFactoryOptions{
+				Env:        []string{"BUILDER_TEST_FACTORY=factory"},
+				InheritEnv: tt.inherit,
+			})
+			cmd := factory.Cmd("true")
+
+			if _, ok := cmd.GetEnv("BUILDER_TEST_INHERITED"); ok != tt.wantOK {
+				t.Errorf("inherited variable set = %v, want %v", ok, tt.wantOK)
+			}
+			if got, _ := cmd.GetEnv("BUILDER_TEST_FACTORY"); got != "factory" {
+				t.Errorf("factory variable = %q, want %q", got, "factory")
+			}
+		})
+	}
+}
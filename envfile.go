@@ -0,0 +1,111 @@
+package builder
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EnvFile adds the variables in the dotenv file at path to the environment of the
+// process. Each line of the file is of the form KEY=VALUE, optionally preceded by
+// 'export'. Blank lines and lines starting with '#' are ignored. A value may be
+// quoted with single quotes, taken literally, or double quotes, in which \n, \t, \",
+// and \\ are unescaped. An unquoted value ends at a '#' preceded by a space, and a
+// quoted value may only be followed by a comment.
+// A variable replaces any entry already in the environment with the same key.
+// The file is read when EnvFile is called; if it can't be read or parsed, running the command fails.
+func (cmdBuilder *CmdBuilder) EnvFile(path string) *CmdBuilder {
+	vars, err := readEnvFile(path)
+	if err != nil {
+		cmdBuilder.setErr(err)
+		return cmdBuilder
+	}
+	return cmdBuilder.Env(vars...)
+}
+
+// readEnvFile reads the variables of the dotenv file at path as "key=value" entries
+func readEnvFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var vars []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, err := parseEnvLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		vars = append(vars, key+"="+value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return vars, nil
+}
+
+// parseEnvLine parses a non-blank, non-comment line of a dotenv file
+func parseEnvLine(line string) (string, string, error) {
+	line = strings.TrimPrefix(line, "export ")
+
+	key, value, ok := strings.Cut(line, "=")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" || strings.ContainsAny(key, " \t") {
+		return "", "", fmt.Errorf("invalid line %q, expected KEY=VALUE", line)
+	}
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return key, "", nil
+	}
+
+	switch quote := value[0]; quote {
+	case '\'', '"':
+		end := closingQuote(value, quote)
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated quoted value of %s", key)
+		}
+		if rest := strings.TrimSpace(value[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", "", fmt.Errorf("unexpected %q after quoted value of %s", rest, key)
+		}
+
+		value = value[1:end]
+		if quote == '"' {
+			value = unescapeEnvValue(value)
+		}
+	default:
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+	}
+
+	return key, value, nil
+}
+
+// closingQuote returns the index of the quote closing the value opened by the quote
+// at its start, skipping quotes escaped in a double quoted value, or -1 if there's none
+func closingQuote(value string, quote byte) int {
+	for i := 1; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && quote == '"':
+			i++
+		case value[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// unescapeEnvValue replaces the escape sequences of a double quoted dotenv value
+func unescapeEnvValue(value string) string {
+	return strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\"`, `"`, `\\`, `\`).Replace(value)
+}
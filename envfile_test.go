@@ -0,0 +1,79 @@
+package builder
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseEnvLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		key     string
+		value   string
+		wantErr bool
+	}{
+		{line: "A=a", key: "A", value: "a"},
+		{line: "export A=a", key: "A", value: "a"},
+		{line: "A = a ", key: "A", value: "a"},
+		{line: "A=", key: "A", value: ""},
+		{line: "A=a # comment", key: "A", value: "a"},
+		{line: "A=a#b", key: "A", value: "a#b"},
+		{line: "A='a b'", key: "A", value: "a b"},
+		{line: `A='a\nb'`, key: "A", value: `a\nb`},
+		{line: `A="a\nb"`, key: "A", value: "a\nb"},
+		{line: `A="a \"b\""`, key: "A", value: `a "b"`},
+		{line: `A="a\\"`, key: "A", value: `a\`},
+		{line: "B='b' # don't", key: "B", value: "b"},
+		{line: `A="a" # "x"`, key: "A", value: "a"},
+		{line: `A="a" #`, key: "A", value: "a"},
+		{line: "A='a' b", wantErr: true},
+		{line: `A="a" "b"`, wantErr: true},
+		{line: "A='a", wantErr: true},
+		{line: `A="a\"`, wantErr: true},
+		{line: "A", wantErr: true},
+		{line: "=a", wantErr: true},
+		{line: "A B=a", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			key, value, err := parseEnvLine(tt.line)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseEnvLine() = %q, %q, want an error", key, value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseEnvLine() error = %v", err)
+			}
+			if key != tt.key || value != tt.value {
+				t.Errorf("parseEnvLine() = %q, %q, want %q, %q", key, value, tt.key, tt.value)
+			}
+		})
+	}
+}
+
+func TestEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	data := "# comment\n\nA=a\nexport B='b' # don't\nC=\"c\" # \"x\"\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := Cmd("true").ClearEnv().EnvFile(path)
+	if cmd.err != nil {
+		t.Fatalf("EnvFile() error = %v", cmd.err)
+	}
+	want := []string{"A=a", "B=b", "C=c"}
+	got := cmd.EnvVars()
+	if len(got) != len(want) {
+		t.Fatalf("EnvVars() = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("EnvVars() = %q, want %q", got, want)
+		}
+	}
+}
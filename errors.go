@@ -0,0 +1,223 @@
+package builder
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// CmdError is returned when a command fails to start or exits unsuccessfully.
+// It describes the command that failed and wraps the underlying error, e.g. an
+// *exec.ExitError, *ExitError, or *TimeoutError.
+type CmdError struct {
+	// Name is the name of the program
+	Name string
+	// Args are the arguments of the command, not including the name,
+	// with any secrets hidden by MaskArgs
+	Args []string
+	// Dir is the working directory of the command
+	Dir string
+	// ExitCode is the exit code of the command or -1 if it didn't exit,
+	// e.g. because it failed to start or was killed by a signal
+	ExitCode int
+	// Stderr is the standard error of the command, if it was captured
+	Stderr string
+	Err    error
+}
+
+// cmdError wraps a non-nil err from starting or waiting on the command
+// in a *CmdError, unless it already is one
+func (cmdBuilder *CmdBuilder) cmdError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*CmdError); ok {
+		return err
+	}
+
+	args := cmdBuilder.args()
+	masked := make([]string, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		masked = append(masked, cmdBuilder.maskArg(arg))
+	}
+
+	cmdErr := &CmdError{
+		Name:     cmdBuilder.name,
+		Args:     masked,
+		Dir:      cmdBuilder.cmd.Dir,
+		ExitCode: -1,
+		Err:      err,
+	}
+	if cmdBuilder.cmd.ProcessState != nil {
+		cmdErr.ExitCode = cmdBuilder.cmd.ProcessState.ExitCode()
+	}
+	return cmdErr
+}
+
+func (e *CmdError) Error() string {
+	parts := []string{shellQuote(e.Name)}
+	for _, arg := range e.Args {
+		parts = append(parts, shellQuote(arg))
+	}
+
+	cmd := strings.Join(parts, " ")
+	if e.Dir != "" {
+		cmd += " (in " + e.Dir + ")"
+	}
+	return fmt.Sprintf("%s: %s", cmd, e.Err)
+}
+
+func (e *CmdError) Unwrap() error {
+	return e.Err
+}
+
+// isExitError reports whether err is from a command that exited with a non-zero status
+func isExitError(err error) bool {
+	err = lastError(err)
+	if cmdErr, ok := err.(*CmdError); ok {
+		err = cmdErr.Err
+	}
+
+	switch err.(type) {
+	case *exec.ExitError, *ExitError, *ExitStatusError:
+		return true
+	}
+	return false
+}
+
+// TimeoutError is returned when a command is stopped because it ran longer
+// than its configured timeout or past its deadline
+type TimeoutError struct {
+	// Timeout is the timeout of the run
+	Timeout time.Duration
+	// Deadline is the deadline the command missed, if it was stopped
+	// because of its Deadline rather than its Timeout
+	Deadline time.Time
+	// Duration is how long the command actually ran
+	Duration time.Duration
+	// Err is the error returned from waiting on the stopped command
+	Err error
+}
+
+func (e *TimeoutError) Error() string {
+	if !e.Deadline.IsZero() {
+		return fmt.Sprintf("command missed its deadline of %s (ran for %s)", e.Deadline.Format(time.RFC3339), e.Duration)
+	}
+	return fmt.Sprintf("command timed out after %s (ran for %s)", e.Timeout, e.Duration)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// OutputTooLargeError is returned when a command is killed because the output
+// captured from it exceeded its configured MaxOutput
+type OutputTooLargeError struct {
+	// Limit is the configured maximum number of bytes
+	Limit int64
+	// Output is the output captured up to the limit
+	Output []byte
+}
+
+func (e *OutputTooLargeError) Error() string {
+	return fmt.Sprintf("command output exceeded %d bytes", e.Limit)
+}
+
+// PipelineError is returned when one or more stages of a pipeline fail
+type PipelineError struct {
+	// Errors holds the error of each stage of the pipeline, in order.
+	// Stages that succeeded have a nil error.
+	Errors []error
+}
+
+func (e *PipelineError) Error() string {
+	var msgs []string
+	for i, err := range e.Errors {
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("stage %d: %s", i, err))
+		}
+	}
+	return "pipeline failed: " + strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the errors of the stages that failed
+func (e *PipelineError) Unwrap() []error {
+	var errs []error
+	for _, err := range e.Errors {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// ExitError is returned when a command exits with a non-zero status
+// and its standard error was captured
+type ExitError struct {
+	Err    *exec.ExitError
+	stderr string
+}
+
+// withStderr wraps err in an *ExitError if it is an *exec.ExitError.
+// If err is a *CmdError, the error it wraps is wrapped instead and it records the stderr.
+func withStderr(err error, stderr string) error {
+	// the stderr is from the last attempt of a retried command
+	if last := lastError(err); last != err {
+		withStderr(last, stderr)
+		return err
+	}
+
+	if cmdErr, ok := err.(*CmdError); ok {
+		if exitErr, ok := cmdErr.Err.(*exec.ExitError); ok {
+			cmdErr.Err = withStderr(exitErr, stderr)
+			cmdErr.Stderr = strings.TrimSpace(stderr)
+		}
+		return cmdErr
+	}
+
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return &ExitError{
+			Err:    exitErr,
+			stderr: strings.TrimSpace(stderr),
+		}
+	}
+	return err
+}
+
+func (e *ExitError) Error() string {
+	if e.stderr == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s: %s", e.Err, e.stderr)
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// Stderr returns the captured standard error of the command
+func (e *ExitError) Stderr() string {
+	return e.stderr
+}
+
+// ExitCode returns the exit code of the command
+func (e *ExitError) ExitCode() int {
+	return e.Err.ExitCode()
+}
+
+// ExitStatusError is the error of a command that exited with a non-zero status
+// without a process to describe it, e.g. a fake command of the buildertest package.
+// It's treated like an *exec.ExitError, e.g. by Capture.
+type ExitStatusError struct {
+	Code int
+}
+
+func (e *ExitStatusError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// ExitCode returns the exit code of the command
+func (e *ExitStatusError) ExitCode() int {
+	return e.Code
+}
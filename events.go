@@ -0,0 +1,205 @@
+package builder
+
+import (
+	"context"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// EventType is the type of an Event
+type EventType int
+
+const (
+	// EventStarted is published when the process of a command has started
+	EventStarted EventType = iota
+	// EventOutputLine is published for each line the command writes to stdout or stderr
+	EventOutputLine
+	// EventExited is published when the process of a command has exited
+	EventExited
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventStarted:
+		return "started"
+	case EventOutputLine:
+		return "output line"
+	case EventExited:
+		return "exited"
+	}
+	return "unknown"
+}
+
+// Event is a lifecycle event of a command created by a factory, see CmdFactory.Events
+type Event struct {
+	Type EventType
+	// Builder is the builder of the command, which tells apart the commands
+	// of the factory, even those with the same command line
+	Builder *CmdBuilder
+	// Command is the command line of the command, see CmdBuilder.String
+	Command string
+	// Pid is the process id of the command
+	Pid  int
+	Time time.Time
+
+	// Line is the line written by the command to Stream, "stdout" or "stderr",
+	// for an EventOutputLine
+	Line   string
+	Stream string
+
+	// ExitCode, Duration, and Err describe how the command exited for an EventExited
+	ExitCode int
+	Duration time.Duration
+	Err      error
+}
+
+// eventBufferSize is the capacity of the channels returned by CmdFactory.Events
+const eventBufferSize = 64
+
+// eventHub publishes the events of the commands created by a factory to its subscribers
+type eventHub struct {
+	mu   sync.Mutex
+	subs []*subscriber
+}
+
+// subscriber is a channel returned by CmdFactory.Events
+type subscriber struct {
+	// mu is held while an event is sent so the channel isn't closed meanwhile
+	mu     sync.Mutex
+	ch     chan Event
+	done   <-chan struct{}
+	closed bool
+}
+
+// Events returns a channel that receives the lifecycle events of every command
+// created by the factory from then on: when it starts, each line of its output,
+// and when it exits, e.g. to monitor many concurrent commands from one place.
+// The events of a command are received in order, though the lines of its stdout
+// and stderr may interleave. The channel must be drained until ctx is done,
+// otherwise the factory's commands block. Once ctx is done the events are no longer
+// sent and the channel is closed. Each call returns a new channel receiving every
+// event. Only factories created with NewFactory publish events.
+// The lines of a stream read through StdoutPipe or StderrPipe aren't published.
+func (factory CmdFactory) Events(ctx context.Context) <-chan Event {
+	if factory.events == nil {
+		return nil
+	}
+	return factory.events.subscribe(ctx)
+}
+
+func (hub *eventHub) subscribe(ctx context.Context) <-chan Event {
+	sub := &subscriber{ch: make(chan Event, eventBufferSize), done: ctx.Done()}
+
+	hub.mu.Lock()
+	hub.subs = append(hub.subs, sub)
+	hub.mu.Unlock()
+
+	if sub.done != nil {
+		go func() {
+			<-sub.done
+			hub.unsubscribe(sub)
+		}()
+	}
+	return sub.ch
+}
+
+// unsubscribe removes the subscriber and closes its channel
+func (hub *eventHub) unsubscribe(sub *subscriber) {
+	hub.mu.Lock()
+	for i, s := range hub.subs {
+		if s == sub {
+			hub.subs = append(hub.subs[:i:i], hub.subs[i+1:]...)
+			break
+		}
+	}
+	hub.mu.Unlock()
+
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	sub.closed = true
+	close(sub.ch)
+}
+
+// subscribed reports whether anyone receives the events
+func (hub *eventHub) subscribed() bool {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	return len(hub.subs) > 0
+}
+
+func (hub *eventHub) publish(event Event) {
+	hub.mu.Lock()
+	subs := hub.subs
+	hub.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.send(event)
+	}
+}
+
+// send sends the event unless the subscriber's context is done
+func (sub *subscriber) send(event Event) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if sub.closed {
+		return
+	}
+
+	select {
+	case sub.ch <- event:
+	case <-sub.done:
+	}
+}
+
+// publishEvents registers the hooks publishing the builder's events to the hub
+func (hub *eventHub) publishEvents(builder *CmdBuilder) {
+	event := func(t EventType) Event {
+		return Event{
+			Type:    t,
+			Builder: builder,
+			Command: builder.String(),
+			Pid:     builder.Pid(),
+			Time:    time.Now(),
+		}
+	}
+
+	// the output may be copied before the OnStart hooks are called, so
+	// whichever comes first publishes the start of the run
+	var mu sync.Mutex
+	started := false
+	start := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if !started {
+			started = true
+			hub.publish(event(EventStarted))
+		}
+	}
+	line := func(stream string) func(line string) {
+		return func(line string) {
+			start()
+			e := event(EventOutputLine)
+			e.Line, e.Stream = line, stream
+			hub.publish(e)
+		}
+	}
+
+	builder.OnStart(func(*exec.Cmd) {
+		start()
+	})
+	builder.stdoutEvent = line("stdout")
+	builder.stderrEvent = line("stderr")
+	builder.OnExit(func(cmd *exec.Cmd, err error) {
+		mu.Lock()
+		started = false
+		mu.Unlock()
+
+		e := event(EventExited)
+		e.ExitCode, e.Duration, e.Err = -1, builder.state.duration, err
+		if cmd.ProcessState != nil {
+			e.ExitCode = cmd.ProcessState.ExitCode()
+		}
+		hub.publish(e)
+	})
+}
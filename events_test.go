@@ -0,0 +1,80 @@
+//go:build unix
+
+package builder
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestEventsStdoutPipe(t *testing.T) {
+	factory := NewFactory(CmdFactoryOptions{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := factory.Events(ctx)
+
+	cmd := factory.Cmd("sh", "-c", "echo out; echo err >&2").DiscardStderr()
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	output, err := io.ReadAll(stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	if got := string(output); got != "out\n" {
+		t.Errorf("read %q from the pipe, want %q", got, "out\n")
+	}
+
+	var got []string
+	for event := range events {
+		if event.Type == EventOutputLine {
+			got = append(got, event.Stream+": "+event.Line)
+		}
+		if event.Type == EventExited {
+			break
+		}
+	}
+	if len(got) != 1 || got[0] != "stderr: err" {
+		t.Errorf("output line events = %q, want only the line of stderr", got)
+	}
+}
+
+func TestEventsUnsubscribe(t *testing.T) {
+	factory := NewFactory(CmdFactoryOptions{})
+	ctx, cancel := context.WithCancel(context.Background())
+	events := factory.Events(ctx)
+
+	// more lines than the channel holds, so the command blocks until ctx is done
+	cmd := factory.Cmd("seq", "1", "1000").Stdout(io.Discard)
+	done := cmd.RunAsync()
+	select {
+	case err := <-done:
+		t.Fatalf("Run() = %v before the events were received", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the command is still blocked once ctx is done")
+	}
+
+	for range events {
+	}
+	if err := factory.Cmd("true").Run(); err != nil {
+		t.Fatalf("Run() after unsubscribing error = %v", err)
+	}
+}
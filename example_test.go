@@ -0,0 +1,38 @@
+//go:build unix
+
+package builder_test
+
+import (
+	"os"
+	"sync"
+
+	builder "github.com/Stage2Sec/cmd-builder"
+)
+
+// The commands share the factory's stdout, which SyncStreams makes safe to write
+// to concurrently, and PrefixOutput tells their lines apart
+func ExampleCmdFactoryOptions_syncStreams() {
+	factory := builder.NewFactory(builder.CmdFactoryOptions{
+		Stdout:      os.Stdout,
+		Stderr:      os.Stdout,
+		SyncStreams: true,
+	})
+
+	var wg sync.WaitGroup
+	for _, host := range []string{"alpha", "beta", "gamma"} {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			factory.Cmd("sh", "-c", "echo up; echo slow >&2").PrefixOutput(host + ": ").Run()
+		}(host)
+	}
+	wg.Wait()
+
+	// Unordered output:
+	// alpha: up
+	// alpha: slow
+	// beta: up
+	// beta: slow
+	// gamma: up
+	// gamma: slow
+}
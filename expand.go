@@ -0,0 +1,69 @@
+package builder
+
+import "os"
+
+// ExpandArgs expands $VAR and ${VAR} in the command's arguments using the
+// command's environment, including any variables added with Env. The arguments
+// are expanded when the command is built or started. Unknown variables expand
+// to an empty string.
+func (cmdBuilder *CmdBuilder) ExpandArgs() *CmdBuilder {
+	return cmdBuilder.ExpandArgsFunc(nil)
+}
+
+// ExpandArgsFunc is like ExpandArgs except unknown variables expand to the result
+// of calling unknown with the variable's name. A nil unknown expands them to an
+// empty string.
+func (cmdBuilder *CmdBuilder) ExpandArgsFunc(unknown func(name string) string) *CmdBuilder {
+	cmdBuilder.expandArgs = true
+	cmdBuilder.expandUnknown = unknown
+	return cmdBuilder
+}
+
+// args returns the arguments the command runs with, expanded if ExpandArgs is set.
+// The name of the command, Args[0], is never expanded.
+func (cmdBuilder *CmdBuilder) args() []string {
+	args := cmdBuilder.cmd.Args
+	if !cmdBuilder.expandArgs || len(args) == 0 {
+		return args
+	}
+
+	expanded := append(make([]string, 0, len(args)), args[0])
+	for _, arg := range args[1:] {
+		expanded = append(expanded, os.Expand(arg, cmdBuilder.expandVar))
+	}
+	return expanded
+}
+
+// expandVar returns the value of the variable in the command's environment
+func (cmdBuilder *CmdBuilder) expandVar(name string) string {
+	var value string
+	var ok bool
+	if cmdBuilder.cmd.Env == nil {
+		value, ok = os.LookupEnv(name)
+	} else {
+		value, ok = getEnv(cmdBuilder.cmd.Env, name)
+	}
+
+	if !ok && cmdBuilder.expandUnknown != nil {
+		return cmdBuilder.expandUnknown(name)
+	}
+	return value
+}
+
+// expand expands the command's arguments for the run and wraps the command to set
+// its umask and resource limits, if any. The command is restored by restoreArgs.
+func (cmdBuilder *CmdBuilder) expand() {
+	cmdBuilder.state.path, cmdBuilder.state.args = cmdBuilder.cmd.Path, cmdBuilder.cmd.Args
+	cmdBuilder.cmd.Args = cmdBuilder.args()
+	cmdBuilder.wrapCmd()
+}
+
+// restoreArgs restores the command changed by expand
+func (cmdBuilder *CmdBuilder) restoreArgs() {
+	if cmdBuilder.state.args == nil {
+		return
+	}
+
+	cmdBuilder.cmd.Path, cmdBuilder.cmd.Args = cmdBuilder.state.path, cmdBuilder.state.args
+	cmdBuilder.state.path, cmdBuilder.state.args = "", nil
+}
@@ -0,0 +1,138 @@
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+)
+
+// StdoutFile writes the command's stdout to the file at path, creating or
+// truncating it. The file is opened when the command is started and closed
+// after it exits.
+func (cmdBuilder *CmdBuilder) StdoutFile(path string) *CmdBuilder {
+	cmdBuilder.cmd.Stdout = &fileStream{path: path, flag: os.O_WRONLY | os.O_CREATE | os.O_TRUNC}
+	return cmdBuilder
+}
+
+// AppendStdoutFile is like StdoutFile except the output is appended to the file
+func (cmdBuilder *CmdBuilder) AppendStdoutFile(path string) *CmdBuilder {
+	cmdBuilder.cmd.Stdout = &fileStream{path: path, flag: os.O_WRONLY | os.O_CREATE | os.O_APPEND}
+	return cmdBuilder
+}
+
+// StderrFile writes the command's stderr to the file at path, creating or
+// truncating it. The file is opened when the command is started and closed
+// after it exits.
+func (cmdBuilder *CmdBuilder) StderrFile(path string) *CmdBuilder {
+	cmdBuilder.cmd.Stderr = &fileStream{path: path, flag: os.O_WRONLY | os.O_CREATE | os.O_TRUNC}
+	return cmdBuilder
+}
+
+// StdinFile reads the command's stdin from the file at path. The file is opened
+// when the command is started and closed after it exits. A stage of a pipeline
+// reads stdin from the previous stage so its stdin can't be a file.
+func (cmdBuilder *CmdBuilder) StdinFile(path string) *CmdBuilder {
+	cmdBuilder.cmd.Stdin = &fileStream{path: path, flag: os.O_RDONLY}
+	return cmdBuilder
+}
+
+// fileStream is a stream of the command that is a file the builder opens for each run.
+// It stands in for the file in the command's configuration so it can be replaced
+// like any other stream, and is swapped for the opened file while the command runs.
+type fileStream struct {
+	path string
+	flag int
+}
+
+// Read and Write fail since the file is only used once the builder opens it.
+// This happens if the command is built with Build and started without the builder.
+func (fs *fileStream) Read(p []byte) (int, error) {
+	return 0, fmt.Errorf("%s: file not opened by the builder", fs.path)
+}
+
+func (fs *fileStream) Write(p []byte) (int, error) {
+	return 0, fmt.Errorf("%s: file not opened by the builder", fs.path)
+}
+
+// open opens the file
+func (fs *fileStream) open() (*os.File, error) {
+	return os.OpenFile(fs.path, fs.flag, 0666)
+}
+
+// redirect renders the shell redirection of the file stream using op, e.g. "> path".
+// Files opened for appending use the appending form of op, e.g. ">> path".
+func (fs *fileStream) redirect(op string) string {
+	if fs.flag&os.O_APPEND != 0 {
+		op += ">"
+	}
+	return op + " " + shellQuote(fs.path)
+}
+
+// openFiles opens the files of any file streams and sets them as the command's
+// streams for the run, along with a fresh reader for stdin set with StdinString
+// or StdinBytes. The file streams and the data are restored by closeFiles.
+func (cmdBuilder *CmdBuilder) openFiles() error {
+	if data, ok := cmdBuilder.cmd.Stdin.(*stdinData); ok {
+		cmdBuilder.state.stdinData = data
+		cmdBuilder.cmd.Stdin = bytes.NewReader(data.data)
+	}
+
+	if fs, ok := cmdBuilder.cmd.Stdin.(*fileStream); ok {
+		f, err := fs.open()
+		if err != nil {
+			return err
+		}
+		cmdBuilder.state.stdinFile = fs
+		cmdBuilder.state.files = append(cmdBuilder.state.files, f)
+		cmdBuilder.cmd.Stdin = f
+	}
+
+	if fs, ok := cmdBuilder.cmd.Stdout.(*fileStream); ok {
+		f, err := fs.open()
+		if err != nil {
+			cmdBuilder.closeFiles()
+			return err
+		}
+		cmdBuilder.state.stdoutFile = fs
+		cmdBuilder.state.files = append(cmdBuilder.state.files, f)
+		cmdBuilder.cmd.Stdout = f
+	}
+
+	if fs, ok := cmdBuilder.cmd.Stderr.(*fileStream); ok {
+		f, err := fs.open()
+		if err != nil {
+			cmdBuilder.closeFiles()
+			return err
+		}
+		cmdBuilder.state.stderrFile = fs
+		cmdBuilder.state.files = append(cmdBuilder.state.files, f)
+		cmdBuilder.cmd.Stderr = f
+	}
+
+	return nil
+}
+
+// closeFiles closes the files opened by openFiles and restores the file streams
+func (cmdBuilder *CmdBuilder) closeFiles() {
+	if cmdBuilder.state.stdinFile != nil {
+		cmdBuilder.cmd.Stdin = cmdBuilder.state.stdinFile
+		cmdBuilder.state.stdinFile = nil
+	}
+	if cmdBuilder.state.stdinData != nil {
+		cmdBuilder.cmd.Stdin = cmdBuilder.state.stdinData
+		cmdBuilder.state.stdinData = nil
+	}
+	if cmdBuilder.state.stdoutFile != nil {
+		cmdBuilder.cmd.Stdout = cmdBuilder.state.stdoutFile
+		cmdBuilder.state.stdoutFile = nil
+	}
+	if cmdBuilder.state.stderrFile != nil {
+		cmdBuilder.cmd.Stderr = cmdBuilder.state.stderrFile
+		cmdBuilder.state.stderrFile = nil
+	}
+
+	for _, f := range cmdBuilder.state.files {
+		f.Close()
+	}
+	cmdBuilder.state.files = nil
+}
@@ -0,0 +1,50 @@
+package builder
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// ForwardSignals relays the signals to the process when the current process
+// receives them while the command is running, e.g. so Ctrl-C stops the command
+// instead of orphaning it. The signals are no longer caught once the command exits.
+// Without any signals, os.Interrupt and SIGTERM are forwarded.
+func (cmdBuilder *CmdBuilder) ForwardSignals(signals ...os.Signal) *CmdBuilder {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+
+	cmdBuilder.forwardSignals = signals
+	return cmdBuilder
+}
+
+// forward relays the signals the current process receives to the started
+// process until done is closed
+func (cmdBuilder *CmdBuilder) forward(done <-chan struct{}) {
+	process := cmdBuilder.cmd.Process
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, cmdBuilder.forwardSignals...)
+
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case sig := <-signals:
+				process.Signal(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// forwards reports whether sig is relayed to the process by ForwardSignals
+func (cmdBuilder *CmdBuilder) forwards(sig os.Signal) bool {
+	for _, forwarded := range cmdBuilder.forwardSignals {
+		if forwarded == sig {
+			return true
+		}
+	}
+	return false
+}
@@ -1,3 +1,8 @@
 module github.com/Stage2Sec/cmd-builder
 
-go 1.17
+go 1.20
+
+require (
+	github.com/creack/pty v1.1.21
+	golang.org/x/sys v0.25.0
+)
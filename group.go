@@ -0,0 +1,98 @@
+package builder
+
+import (
+	"context"
+	"sync"
+)
+
+// Group runs commands concurrently with bounded parallelism,
+// e.g. to run the same tool against many inputs
+type Group struct {
+	concurrency int
+	failFast    bool
+	builders    []*CmdBuilder
+}
+
+// NewGroup returns a group that runs at most concurrency commands at a time.
+// If concurrency is 0 or less, every command is run at once.
+func NewGroup(concurrency int) *Group {
+	return &Group{concurrency: concurrency}
+}
+
+// RunAll runs the commands with at most concurrency running at a time and returns
+// the result of each in the order they were given. A failed command doesn't stop the others.
+func RunAll(concurrency int, builders ...*CmdBuilder) []RunResult {
+	return NewGroup(concurrency).Add(builders...).Wait()
+}
+
+// Add adds commands to the group
+func (group *Group) Add(builders ...*CmdBuilder) *Group {
+	group.builders = append(group.builders, builders...)
+	return group
+}
+
+// FailFast kills the running commands and skips the ones that haven't started
+// once a command fails. The result of a skipped command has ExitCode -1 and
+// Err set to context.Canceled.
+func (group *Group) FailFast() *Group {
+	group.failFast = true
+	return group
+}
+
+// Wait runs the commands of the group and returns the result of each, like
+// Capture, in the order they were added. Err is set for the commands that failed.
+func (group *Group) Wait() []RunResult {
+	results := make([]RunResult, len(group.builders))
+
+	concurrency := group.concurrency
+	if concurrency <= 0 || concurrency > len(group.builders) {
+		concurrency = len(group.builders)
+	}
+	sem := make(chan struct{}, concurrency)
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		failed  bool
+		cancels = make(map[int]context.CancelFunc)
+	)
+
+	for i, builder := range group.builders {
+		sem <- struct{}{}
+
+		mu.Lock()
+		if failed {
+			mu.Unlock()
+			<-sem
+			results[i] = RunResult{ExitCode: -1, Err: context.Canceled}
+			continue
+		}
+		ctx, cancel := context.WithCancel(builder.context())
+		cancels[i] = cancel
+		mu.Unlock()
+
+		wg.Add(1)
+		go func(i int, builder *CmdBuilder) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			result := builder.captureContext(ctx)
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[i] = result
+			delete(cancels, i)
+			cancel()
+
+			if result.Err != nil && group.failFast && !failed {
+				failed = true
+				for _, cancel := range cancels {
+					cancel()
+				}
+			}
+		}(i, builder)
+	}
+
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,43 @@
+package builder
+
+import "time"
+
+// Heartbeat calls fn every interval with the time elapsed since the command
+// started while it is running, e.g. to tell users a long, quiet command is still
+// running. fn is called from another goroutine, one call at a time, and is no
+// longer called once the command has exited: waiting on the command waits for
+// a call in progress to return. Each call replaces the previous heartbeat.
+// An interval of 0 or less disables the heartbeat.
+func (cmdBuilder *CmdBuilder) Heartbeat(interval time.Duration, fn func(elapsed time.Duration)) *CmdBuilder {
+	cmdBuilder.heartbeatInterval = interval
+	cmdBuilder.heartbeat = fn
+	return cmdBuilder
+}
+
+// beat calls the heartbeat function every interval until done is closed.
+// stopped is closed once it is no longer called.
+func (cmdBuilder *CmdBuilder) beat(done <-chan struct{}) (stopped <-chan struct{}) {
+	started, fn := cmdBuilder.state.started, cmdBuilder.heartbeat
+	ticker := time.NewTicker(cmdBuilder.heartbeatInterval)
+	stop := make(chan struct{})
+
+	go func() {
+		defer close(stop)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				// the command may have exited while waiting for the ticker
+				select {
+				case <-done:
+					return
+				default:
+				}
+				fn(time.Since(started))
+			case <-done:
+				return
+			}
+		}
+	}()
+	return stop
+}
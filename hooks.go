@@ -0,0 +1,30 @@
+package builder
+
+import (
+	"os/exec"
+	"time"
+)
+
+// OnStart registers a hook that is called every time the process is started,
+// after it has been spawned so cmd.Process is populated.
+// Hooks are called in the order they were registered.
+func (cmdBuilder *CmdBuilder) OnStart(fn func(cmd *exec.Cmd)) *CmdBuilder {
+	cmdBuilder.onStart = append(cmdBuilder.onStart, fn)
+	return cmdBuilder
+}
+
+// OnExit registers a hook that is called every time the process exits, after
+// waiting on it, with the error it exited with.
+// Hooks are called in the order they were registered.
+func (cmdBuilder *CmdBuilder) OnExit(fn func(cmd *exec.Cmd, err error)) *CmdBuilder {
+	cmdBuilder.onExit = append(cmdBuilder.onExit, fn)
+	return cmdBuilder
+}
+
+// OnComplete registers a hook that is called every time the command exits with
+// how long it ran and the error it exited with, e.g. for pushing metrics.
+// Hooks are called in the order they were registered.
+func (cmdBuilder *CmdBuilder) OnComplete(fn func(d time.Duration, err error)) *CmdBuilder {
+	cmdBuilder.onComplete = append(cmdBuilder.onComplete, fn)
+	return cmdBuilder
+}
@@ -0,0 +1,164 @@
+//go:build windows
+
+package builder
+
+import (
+	"errors"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// treeState holds the Job Object the process and its children are assigned to
+type treeState struct {
+	job windows.Handle
+	// suspended is true if the process is started suspended by startProcessTree
+	suspended bool
+}
+
+// startProcessTree starts the process with the CREATE_SUSPENDED creation flag so it
+// can't start any children before attachProcessTree assigns it to a Job Object
+func (cmdBuilder *CmdBuilder) startProcessTree() {
+	attr := cmdBuilder.sysProcAttr()
+	// a process already started suspended is left for the caller to resume
+	if attr.CreationFlags&windows.CREATE_SUSPENDED != 0 {
+		return
+	}
+	attr.CreationFlags |= windows.CREATE_SUSPENDED
+	cmdBuilder.state.tree = &treeState{suspended: true}
+}
+
+// attachProcessTree assigns the started process to a new Job Object that kills every
+// process in it once closed, so the children the process starts are assigned to it
+// too, then resumes it. If the job can't be set up, only the process itself is killed.
+func (cmdBuilder *CmdBuilder) attachProcessTree() {
+	if tree := cmdBuilder.state.tree; tree != nil && tree.suspended {
+		cmdBuilder.state.tree = nil
+		cmdBuilder.sysProcAttr().CreationFlags &^= windows.CREATE_SUSPENDED
+		defer cmdBuilder.resumeProcess()
+	}
+
+	job, err := newKillOnCloseJob()
+	if err != nil {
+		return
+	}
+
+	process, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, uint32(cmdBuilder.cmd.Process.Pid))
+	if err != nil {
+		windows.CloseHandle(job)
+		return
+	}
+	defer windows.CloseHandle(process)
+
+	if err := windows.AssignProcessToJobObject(job, process); err != nil {
+		windows.CloseHandle(job)
+		return
+	}
+	cmdBuilder.state.tree = &treeState{job: job}
+}
+
+// newKillOnCloseJob creates a Job Object with the JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE limit
+func newKillOnCloseJob() (windows.Handle, error) {
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	info := windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION{}
+	info.BasicLimitInformation.LimitFlags = windows.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE
+	_, err = windows.SetInformationJobObject(job, windows.JobObjectExtendedLimitInformation,
+		uintptr(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info)))
+	if err != nil {
+		windows.CloseHandle(job)
+		return 0, err
+	}
+	return job, nil
+}
+
+// resumeProcess resumes the process started suspended. If it can't be, it's killed
+// rather than left suspended.
+func (cmdBuilder *CmdBuilder) resumeProcess() {
+	if err := resumeThreads(uint32(cmdBuilder.cmd.Process.Pid)); err != nil {
+		cmdBuilder.cmd.Process.Kill()
+	}
+}
+
+// resumeThreads resumes the threads of the process, which a process started
+// suspended only has one of
+func resumeThreads(pid uint32) error {
+	snapshot, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPTHREAD, 0)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(snapshot)
+
+	resumed := false
+	entry := windows.ThreadEntry32{Size: uint32(unsafe.Sizeof(windows.ThreadEntry32{}))}
+	for err = windows.Thread32First(snapshot, &entry); err == nil; err = windows.Thread32Next(snapshot, &entry) {
+		if entry.OwnerProcessID != pid {
+			continue
+		}
+
+		thread, err := windows.OpenThread(windows.THREAD_SUSPEND_RESUME, false, entry.ThreadID)
+		if err != nil {
+			return err
+		}
+		_, err = windows.ResumeThread(thread)
+		windows.CloseHandle(thread)
+		if err != nil {
+			return err
+		}
+		resumed = true
+	}
+
+	if !resumed {
+		return errors.New("no thread of the process to resume")
+	}
+	return nil
+}
+
+// closeProcessTree closes the Job Object of the run, which kills the
+// children of the process that are still running. If the process never
+// started, the creation flag set by startProcessTree is removed.
+func (cmdBuilder *CmdBuilder) closeProcessTree() {
+	tree := cmdBuilder.state.tree
+	if tree == nil {
+		return
+	}
+	cmdBuilder.state.tree = nil
+
+	if tree.suspended {
+		cmdBuilder.sysProcAttr().CreationFlags &^= windows.CREATE_SUSPENDED
+		return
+	}
+	windows.CloseHandle(tree.job)
+}
+
+// jobTree is the started process and the Job Object it is assigned to
+type jobTree struct {
+	process *os.Process
+	job     windows.Handle
+}
+
+// processTree returns the Job Object of the started process, or the process
+// itself if it isn't assigned to one
+func (cmdBuilder *CmdBuilder) processTree() signaler {
+	if tree := cmdBuilder.state.tree; tree != nil {
+		return jobTree{process: cmdBuilder.cmd.Process, job: tree.job}
+	}
+	return cmdBuilder.cmd.Process
+}
+
+// Signal kills every process of the job for os.Kill and signals the process otherwise
+func (tree jobTree) Signal(sig os.Signal) error {
+	if sig == os.Kill {
+		return tree.Kill()
+	}
+	return tree.process.Signal(sig)
+}
+
+// Kill terminates every process of the job
+func (tree jobTree) Kill() error {
+	return windows.TerminateJobObject(tree.job, 1)
+}
@@ -0,0 +1,46 @@
+package builder
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// jsonSnippetLen is the maximum length of the output included in a *JSONError
+const jsonSnippetLen = 200
+
+// JSONError is returned by OutputJSON when the command's output is not valid JSON
+type JSONError struct {
+	Err error
+	// Snippet is the beginning of the offending output
+	Snippet string
+}
+
+func (e *JSONError) Error() string {
+	return fmt.Sprintf("output is not valid JSON: %s: %q", e.Err, e.Snippet)
+}
+
+func (e *JSONError) Unwrap() error {
+	return e.Err
+}
+
+// OutputJSON runs the command and decodes its standard output as JSON into a T.
+// If the command fails its error is returned as is, otherwise if the output can't
+// be decoded a *JSONError is returned.
+func OutputJSON[T any](cmdBuilder *CmdBuilder) (T, error) {
+	var result T
+
+	output, err := cmdBuilder.outputBytes(cmdBuilder.context())
+	if err != nil {
+		return result, err
+	}
+
+	if err := json.Unmarshal(output, &result); err != nil {
+		snippet := string(output)
+		if len(snippet) > jsonSnippetLen {
+			snippet = snippet[:jsonSnippetLen] + "..."
+		}
+		return result, &JSONError{Err: err, Snippet: snippet}
+	}
+
+	return result, nil
+}
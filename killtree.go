@@ -0,0 +1,34 @@
+package builder
+
+import "os"
+
+// KillProcessTree kills the children the command started along with the command when
+// it is stopped because its context is done or it timed out, e.g. the node process
+// started by npm, which would otherwise keep running. On Unix the command is started
+// in a new process group, unless it's started in a new session, e.g. with Detach
+// or PTY, and the group is signaled instead of the process. On Windows the process is
+// started suspended and assigned to a Job Object with KILL_ON_JOB_CLOSE before it
+// runs, so none of its children escape the job, which is closed once the command
+// exits, so the children still running then are killed even if the command exited
+// on its own. They are also killed if the current process exits first. On other
+// systems only the process itself is killed.
+// A custom Cancel function is called as is.
+func (cmdBuilder *CmdBuilder) KillProcessTree(enabled bool) *CmdBuilder {
+	cmdBuilder.killTree = enabled
+	return cmdBuilder
+}
+
+// signaler is a process, or a tree of processes, that can be signaled
+type signaler interface {
+	Signal(sig os.Signal) error
+	Kill() error
+}
+
+// target returns what is signaled to stop the started process, its whole tree
+// with KillProcessTree
+func (cmdBuilder *CmdBuilder) target() signaler {
+	if cmdBuilder.killTree {
+		return cmdBuilder.processTree()
+	}
+	return cmdBuilder.cmd.Process
+}
@@ -0,0 +1,17 @@
+//go:build !unix && !windows
+
+package builder
+
+// treeState is unused since the process's children can't be tracked
+type treeState struct{}
+
+func (cmdBuilder *CmdBuilder) startProcessTree() {}
+
+func (cmdBuilder *CmdBuilder) attachProcessTree() {}
+
+func (cmdBuilder *CmdBuilder) closeProcessTree() {}
+
+// processTree returns the started process since its children can't be tracked
+func (cmdBuilder *CmdBuilder) processTree() signaler {
+	return cmdBuilder.cmd.Process
+}
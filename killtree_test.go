@@ -0,0 +1,74 @@
+//go:build unix
+
+package builder
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestKillProcessTree(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cmd := CmdContext(ctx, "sh", "-c", "sleep 30 & echo $!; wait").
+		Stdout(w).
+		KillGrace(time.Second).
+		KillProcessTree(true)
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading the grandchild's pid: %v", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil {
+		t.Fatalf("parsing the grandchild's pid %q: %v", line, err)
+	}
+	// the grandchild would outlive the test if it isn't killed
+	defer syscall.Kill(pid, syscall.SIGKILL)
+
+	cancel()
+	if err := cmd.Wait(); err == nil {
+		t.Fatal("Wait() = nil, want an error once the context is canceled")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !processGone(pid) {
+		if time.Now().After(deadline) {
+			t.Fatalf("grandchild %d is still running", pid)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// processGone reports whether the process exited. An exited process whose parent
+// is gone may stay a zombie until it's reaped, e.g. in a container without an init.
+func processGone(pid int) bool {
+	if err := syscall.Kill(pid, 0); errors.Is(err, syscall.ESRCH) {
+		return true
+	}
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return false
+	}
+	i := strings.LastIndexByte(string(stat), ')')
+	return i >= 0 && strings.HasPrefix(string(stat[i+1:]), " Z")
+}
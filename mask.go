@@ -0,0 +1,61 @@
+package builder
+
+import (
+	"regexp"
+)
+
+// masked replaces secrets in the rendered command
+const masked = "***"
+
+// MaskArgs hides secrets in the arguments matching any of the regular expressions
+// when the command is rendered, e.g. by String, DryRun, and the errors describing
+// the command. If an expression has a group, the text matching the first group
+// is replaced with "***", e.g. `--token=(.*)`, otherwise the whole argument is.
+// The command still runs with the real arguments, which is also what hooks like
+// OnStart are given. An invalid expression returns
+// an error when the command is started.
+func (cmdBuilder *CmdBuilder) MaskArgs(patterns ...string) *CmdBuilder {
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			cmdBuilder.setErr(err)
+			return cmdBuilder
+		}
+		cmdBuilder.maskArgs = append(cmdBuilder.maskArgs, re)
+	}
+	return cmdBuilder
+}
+
+// MaskEnv hides the values of the environment variables with the keys when the
+// command is rendered, e.g. by String and DryRun, replacing them with "***".
+// The command still runs with the real values.
+func (cmdBuilder *CmdBuilder) MaskEnv(keys ...string) *CmdBuilder {
+	cmdBuilder.maskEnv = append(cmdBuilder.maskEnv, keys...)
+	return cmdBuilder
+}
+
+// maskArg returns the argument with any secrets matching MaskArgs replaced
+func (cmdBuilder *CmdBuilder) maskArg(arg string) string {
+	for _, re := range cmdBuilder.maskArgs {
+		match := re.FindStringSubmatchIndex(arg)
+		switch {
+		case match == nil:
+			continue
+		case len(match) >= 4 && match[2] >= 0:
+			arg = arg[:match[2]] + masked + arg[match[3]:]
+		default:
+			return masked
+		}
+	}
+	return arg
+}
+
+// maskValue returns the value of the environment variable, replaced if its key was given to MaskEnv
+func (cmdBuilder *CmdBuilder) maskValue(key, value string) string {
+	for _, k := range cmdBuilder.maskEnv {
+		if envKeyEqual(k, key) {
+			return masked
+		}
+	}
+	return value
+}
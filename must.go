@@ -0,0 +1,57 @@
+package builder
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// MustError is the value MustRun and MustOutput panic with when the command fails
+type MustError struct {
+	// Command is the command line of the command that failed
+	Command string
+	Err     error
+}
+
+func (e *MustError) Error() string {
+	// a *CmdError already describes the command
+	if _, ok := lastError(e.Err).(*CmdError); ok {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s: %s", e.Command, e.Err)
+}
+
+func (e *MustError) Unwrap() error {
+	return e.Err
+}
+
+// MustRun is like Run except it panics with a *MustError if the command, or the
+// chain run after it, fails. Standard error of the command is captured so it can
+// be included in the panic.
+func (cmdBuilder *CmdBuilder) MustRun() {
+	ctx := cmdBuilder.context()
+	var errBuf bytes.Buffer
+	err := cmdBuilder.capture(nil, &errBuf, func() error {
+		return cmdBuilder.run(ctx, errBuf.Reset)
+	})
+	if err != nil {
+		err = withStderr(err, errBuf.String())
+	}
+	if err := cmdBuilder.runChain(ctx, err); err != nil {
+		panic(&MustError{
+			Command: cmdBuilder.String(),
+			Err:     err,
+		})
+	}
+}
+
+// MustOutput is like Output except it panics with a *MustError if the command fails
+func (cmdBuilder *CmdBuilder) MustOutput() string {
+	output, err := cmdBuilder.Output()
+	if err != nil {
+		panic(&MustError{
+			Command: cmdBuilder.String(),
+			Err:     err,
+		})
+	}
+	return output
+}
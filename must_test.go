@@ -0,0 +1,25 @@
+//go:build unix
+
+package builder
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestMustRunChain(t *testing.T) {
+	var out bytes.Buffer
+	Cmd("true").Then(Cmd("echo", "then").Stdout(&out)).MustRun()
+	if got := out.String(); got != "then\n" {
+		t.Errorf("output of the chained command = %q, want %q", got, "then\n")
+	}
+
+	defer func() {
+		var mustErr *MustError
+		if err, _ := recover().(error); !errors.As(err, &mustErr) {
+			t.Errorf("MustRun() panicked with %v, want a *MustError", err)
+		}
+	}()
+	Cmd("true").Then(Cmd("false")).MustRun()
+}
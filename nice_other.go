@@ -0,0 +1,25 @@
+//go:build !unix && !windows
+
+package builder
+
+// Nice is a no-op on systems that are neither Unix nor Windows, which have no
+// process priorities to set
+func (cmdBuilder *CmdBuilder) Nice(level int) *CmdBuilder {
+	return cmdBuilder
+}
+
+// priorityGate is empty since the command doesn't wait for its priority to be set
+type priorityGate struct{}
+
+// openPriorityGate is a no-op since Nice is
+func (cmdBuilder *CmdBuilder) openPriorityGate() error {
+	return nil
+}
+
+// setPriority is a no-op since Nice is
+func (cmdBuilder *CmdBuilder) setPriority() error {
+	return nil
+}
+
+// closePriorityGate is a no-op since Nice is
+func (cmdBuilder *CmdBuilder) closePriorityGate() {}
@@ -0,0 +1,34 @@
+//go:build unix
+
+package builder
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestNice(t *testing.T) {
+	output, err := Cmd("sh", "-c", "ps -o nice= -p $$").Nice(5).Output()
+	if err != nil {
+		t.Fatalf("Output() error = %v", err)
+	}
+	if got := strings.TrimSpace(output); got != "5" {
+		t.Errorf("niceness of the command = %q, want %q", got, "5")
+	}
+}
+
+func TestNiceUnprivileged(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("raising the priority is allowed when running as root")
+	}
+
+	var out strings.Builder
+	err := Cmd("echo", "ran").Stdout(&out).Nice(-20).Run()
+	if err == nil {
+		t.Fatal("Run() = nil, want an error setting the niceness")
+	}
+	if out.Len() > 0 {
+		t.Errorf("the command ran with output %q although its niceness couldn't be set", out.String())
+	}
+}
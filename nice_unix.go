@@ -0,0 +1,81 @@
+//go:build unix
+
+package builder
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Nice runs the command with the specified niceness, from -20 (highest priority)
+// to 19 (lowest priority). The command is run by /bin/sh, which waits until its
+// niceness is set with setpriority before executing the command, so the 'nice'
+// binary isn't needed and nothing the command starts runs at the inherited
+// priority. Raising the priority above the current process's usually requires
+// privileges; if the priority can't be set the command is stopped before it runs
+// and starting it fails.
+//
+// On Windows the niceness is mapped to the closest priority class.
+func (cmdBuilder *CmdBuilder) Nice(level int) *CmdBuilder {
+	cmdBuilder.nice = &level
+	return cmdBuilder
+}
+
+// priorityGate is the pipe the shell running the command reads before executing
+// it, which is written once the niceness of the shell is set
+type priorityGate struct {
+	r, w *os.File
+	// fd is the file descriptor of r in the shell
+	fd int
+	// extraFiles are the command's ExtraFiles before r was added to them
+	extraFiles []*os.File
+}
+
+// openPriorityGate passes the gate to the command, so wrapCmd makes it wait
+// until setPriority sets its niceness
+func (cmdBuilder *CmdBuilder) openPriorityGate() error {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+
+	extraFiles := cmdBuilder.cmd.ExtraFiles
+	cmdBuilder.state.priority = &priorityGate{r: r, w: w, fd: 3 + len(extraFiles), extraFiles: extraFiles}
+	cmdBuilder.cmd.ExtraFiles = append(extraFiles[:len(extraFiles):len(extraFiles)], r)
+	return nil
+}
+
+// prelude returns the shell commands waiting on the gate and closing it
+func (gate *priorityGate) prelude() []string {
+	return []string{fmt.Sprintf("read -r _ <&%d", gate.fd), fmt.Sprintf("exec %d<&-", gate.fd)}
+}
+
+// setPriority sets the niceness of the started process and lets it run
+func (cmdBuilder *CmdBuilder) setPriority() error {
+	pid := cmdBuilder.cmd.Process.Pid
+	err := syscall.Setpriority(syscall.PRIO_PROCESS, pid, *cmdBuilder.nice)
+	if err == nil {
+		_, err = cmdBuilder.state.priority.w.Write([]byte("\n"))
+	}
+	cmdBuilder.closePriorityGate()
+
+	if err != nil {
+		return fmt.Errorf("unable to set the niceness of %s to %d: %w", cmdBuilder.name, *cmdBuilder.nice, err)
+	}
+	return nil
+}
+
+// closePriorityGate closes the gate, which stops a command that wasn't let through,
+// and restores the command's ExtraFiles
+func (cmdBuilder *CmdBuilder) closePriorityGate() {
+	gate := cmdBuilder.state.priority
+	if gate == nil {
+		return
+	}
+	cmdBuilder.state.priority = nil
+
+	gate.r.Close()
+	gate.w.Close()
+	cmdBuilder.cmd.ExtraFiles = gate.extraFiles
+}
@@ -0,0 +1,52 @@
+//go:build windows
+
+package builder
+
+// Windows process priority classes
+const (
+	idlePriorityClass        = 0x00000040
+	belowNormalPriorityClass = 0x00004000
+	aboveNormalPriorityClass = 0x00008000
+	highPriorityClass        = 0x00000080
+)
+
+// Nice runs the command with the priority class closest to the specified
+// niceness, from -20 (highest priority) to 19 (lowest priority):
+// 10 and up is IDLE, 1 to 9 is BELOW_NORMAL, -1 to -9 is ABOVE_NORMAL,
+// and -10 and below is HIGH. A niceness of 0 leaves the priority unchanged.
+func (cmdBuilder *CmdBuilder) Nice(level int) *CmdBuilder {
+	var class uint32
+	switch {
+	case level >= 10:
+		class = idlePriorityClass
+	case level > 0:
+		class = belowNormalPriorityClass
+	case level <= -10:
+		class = highPriorityClass
+	case level < 0:
+		class = aboveNormalPriorityClass
+	default:
+		return cmdBuilder
+	}
+
+	attr := cmdBuilder.sysProcAttr()
+	attr.CreationFlags &^= idlePriorityClass | belowNormalPriorityClass | aboveNormalPriorityClass | highPriorityClass
+	attr.CreationFlags |= class
+	return cmdBuilder
+}
+
+// priorityGate is empty since the command doesn't wait for its priority to be set
+type priorityGate struct{}
+
+// openPriorityGate is a no-op since the priority class is set when the process is created
+func (cmdBuilder *CmdBuilder) openPriorityGate() error {
+	return nil
+}
+
+// setPriority is a no-op since the priority class is set when the process is created
+func (cmdBuilder *CmdBuilder) setPriority() error {
+	return nil
+}
+
+// closePriorityGate is a no-op since openPriorityGate is
+func (cmdBuilder *CmdBuilder) closePriorityGate() {}
@@ -0,0 +1,133 @@
+package builder
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrEmptyCommand is returned when parsing a command string that has no words,
+	// or when running a builder created by CmdArgv with an empty argv
+	ErrEmptyCommand = errors.New("empty command")
+	// ErrUnterminatedQuote is returned when parsing a command string with an unbalanced quote
+	ErrUnterminatedQuote = errors.New("unterminated quote")
+	// ErrTrailingBackslash is returned when parsing a command string that ends with a backslash
+	ErrTrailingBackslash = errors.New("trailing backslash")
+)
+
+// ParseCommand splits the command string into words using shell quoting rules and
+// returns the builder for the resulting command. Single quotes, double quotes, and
+// backslash escapes are supported. No shell is invoked, so variables, globs, and
+// other shell syntax are not expanded, which makes it safe to use with untrusted input.
+func ParseCommand(s string) (*CmdBuilder, error) {
+	argv, err := splitCommand(s)
+	if err != nil {
+		return nil, err
+	}
+	return Cmd(argv[0], argv[1:]...), nil
+}
+
+// ParseCommand is like the package level ParseCommand except the builder
+// is created with the factory's options
+func (factory CmdFactory) ParseCommand(s string) (*CmdBuilder, error) {
+	argv, err := splitCommand(s)
+	if err != nil {
+		return nil, err
+	}
+	return factory.Cmd(argv[0], argv[1:]...), nil
+}
+
+// CmdArgv is like Cmd except it takes the program and its arguments as a single
+// slice, e.g. a command read from a config file. If argv is empty, running the
+// command returns ErrEmptyCommand.
+func CmdArgv(argv []string) *CmdBuilder {
+	return DefaultFactory().CmdArgv(argv)
+}
+
+// CmdArgv is like the package level CmdArgv except the builder
+// is created with the factory's options
+func (factory CmdFactory) CmdArgv(argv []string) *CmdBuilder {
+	if len(argv) == 0 {
+		builder := factory.Cmd("")
+		builder.setErr(ErrEmptyCommand)
+		return builder
+	}
+	return factory.Cmd(argv[0], argv[1:]...)
+}
+
+// splitCommand splits s into words the way a POSIX shell would,
+// without performing any expansions
+func splitCommand(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case r == '\\':
+			i++
+			if i == len(runes) {
+				return nil, ErrTrailingBackslash
+			}
+			// an escaped newline is a line continuation
+			if runes[i] != '\n' {
+				word.WriteRune(runes[i])
+				inWord = true
+			}
+		case r == '\'':
+			end := indexRune(runes, i+1, '\'')
+			if end < 0 {
+				return nil, ErrUnterminatedQuote
+			}
+			word.WriteString(string(runes[i+1 : end]))
+			i = end
+			inWord = true
+		case r == '"':
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				// inside double quotes a backslash only escapes these characters
+				if runes[i] == '\\' && i+1 < len(runes) && strings.ContainsRune("$`\"\\\n", runes[i+1]) {
+					i++
+					if runes[i] == '\n' {
+						continue
+					}
+				}
+				word.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, ErrUnterminatedQuote
+			}
+			inWord = true
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	if len(words) == 0 {
+		return nil, ErrEmptyCommand
+	}
+	return words, nil
+}
+
+// indexRune returns the index of the first r in runes at or after start, or -1
+func indexRune(runes []rune, start int, r rune) int {
+	for i := start; i < len(runes); i++ {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,105 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"os"
+)
+
+// ErrPipedStdinFile is returned when a stage of a pipeline that reads stdin from
+// the previous stage is also given a stdin file with StdinFile
+var ErrPipedStdinFile = errors.New("a piped stage can't read stdin from a file")
+
+// Pipe connects the standard output of the command to the standard input of next,
+// like a shell pipe, and returns next. Running next starts every stage of the
+// pipeline and waits for all of them to complete. The standard error of each
+// stage is still written to that stage's configured writer.
+func (cmdBuilder *CmdBuilder) Pipe(next *CmdBuilder) *CmdBuilder {
+	cmdBuilder.piped = true
+	next.prev = cmdBuilder
+	return next
+}
+
+// Pipeline pipes each builder into the next one and returns the last builder,
+// which can be used to run the whole pipeline. Pipeline panics if no builders are given.
+func Pipeline(builders ...*CmdBuilder) *CmdBuilder {
+	if len(builders) == 0 {
+		panic("builder: Pipeline called with no builders")
+	}
+
+	for i := 1; i < len(builders); i++ {
+		builders[i-1].Pipe(builders[i])
+	}
+	return builders[len(builders)-1]
+}
+
+// stages returns every stage of the pipeline ending with the builder, in order
+func (cmdBuilder *CmdBuilder) stages() []*CmdBuilder {
+	var stages []*CmdBuilder
+	for stage := cmdBuilder; stage != nil; stage = stage.prev {
+		stages = append([]*CmdBuilder{stage}, stages...)
+	}
+	return stages
+}
+
+// startPipeline connects the builder to the previous stage and starts both.
+// The parent's copies of the pipe are closed once the stages are started so that
+// a stage gets EOF on stdin when the stage before it exits.
+func (cmdBuilder *CmdBuilder) startPipeline(ctx context.Context) error {
+	if _, ok := cmdBuilder.cmd.Stdin.(*fileStream); ok {
+		return ErrPipedStdinFile
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+
+	cmdBuilder.prev.cmd.Stdout = w
+	cmdBuilder.cmd.Stdin = r
+
+	err = cmdBuilder.prev.StartContext(ctx)
+	w.Close()
+	if err != nil {
+		r.Close()
+		return err
+	}
+
+	err = cmdBuilder.start(ctx)
+	r.Close()
+	if err != nil {
+		cmdBuilder.prev.kill()
+		cmdBuilder.prev.Wait()
+		return err
+	}
+
+	return nil
+}
+
+// waitPipeline waits for every stage of the pipeline to exit
+func (cmdBuilder *CmdBuilder) waitPipeline() error {
+	stages := cmdBuilder.stages()
+	errs := make([]error, len(stages))
+
+	failed := false
+	for i, stage := range stages {
+		errs[i] = stage.cmdError(stage.wait())
+		if errs[i] != nil {
+			failed = true
+		}
+	}
+
+	if failed {
+		return &PipelineError{Errors: errs}
+	}
+	return nil
+}
+
+// kill kills every started stage of the pipeline ending with the builder
+func (cmdBuilder *CmdBuilder) kill() {
+	for _, stage := range cmdBuilder.stages() {
+		if stage.cmd.Process != nil {
+			stage.cmd.Process.Kill()
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package builder
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// ErrForceKilled is returned by Process.Stop when the process didn't exit
+// within the grace period and had to be killed
+var ErrForceKilled = errors.New("process was force killed")
+
+// Process is a handle to a command running in the background
+type Process struct {
+	builder *CmdBuilder
+	done    chan struct{}
+	err     error
+}
+
+// Background starts the command and returns a handle that can be used to
+// wait for, signal, or kill the running process.
+func (cmdBuilder *CmdBuilder) Background() (*Process, error) {
+	if err := cmdBuilder.Start(); err != nil {
+		return nil, err
+	}
+
+	process := &Process{
+		builder: cmdBuilder,
+		done:    make(chan struct{}),
+	}
+	go func() {
+		process.err = cmdBuilder.Wait()
+		close(process.done)
+	}()
+
+	return process, nil
+}
+
+// Wait waits for the process to exit and returns the same error as CmdBuilder.Wait.
+// Wait can be called multiple times and from multiple goroutines.
+func (process *Process) Wait() error {
+	<-process.done
+	return process.err
+}
+
+// Signal sends the signal to the process. For a pipeline, every stage is signaled.
+func (process *Process) Signal(sig os.Signal) error {
+	var err error
+	for _, stage := range process.builder.stages() {
+		if stage.cmd.Process == nil {
+			continue
+		}
+
+		if serr := stage.cmd.Process.Signal(sig); serr != nil && err == nil {
+			err = serr
+		}
+	}
+	return err
+}
+
+// Kill causes the process to exit immediately. For a pipeline, every stage is killed.
+func (process *Process) Kill() error {
+	return process.Signal(os.Kill)
+}
+
+// KillGroup kills the process group of the process, which includes any children
+// it started. The command must have been started with NewProcessGroup.
+// On Windows only the process itself is killed. For a pipeline, the process group
+// of every stage is killed.
+func (process *Process) KillGroup() error {
+	var err error
+	for _, stage := range process.builder.stages() {
+		if stage.cmd.Process == nil {
+			continue
+		}
+
+		if kerr := killGroup(stage.cmd.Process.Pid); kerr != nil && err == nil {
+			err = kerr
+		}
+	}
+	return err
+}
+
+// Stop gracefully stops the process by sending it SIGTERM, or os.Interrupt on Windows,
+// and waiting up to grace for it to exit. If it's still running after the grace period,
+// or can't be signaled, it is killed and ErrForceKilled is returned.
+// Stop returns nil if the process exited on its own, including if it had already exited.
+func (process *Process) Stop(grace time.Duration) error {
+	if process.Exited() {
+		return nil
+	}
+
+	if err := process.Signal(terminateSignal); err == nil {
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+
+		select {
+		case <-process.done:
+			return nil
+		case <-timer.C:
+		}
+	}
+
+	err := process.Kill()
+	<-process.done
+
+	switch {
+	case errors.Is(err, os.ErrProcessDone):
+		// the process exited on its own just before it was killed
+		return nil
+	case err != nil:
+		return err
+	}
+	return ErrForceKilled
+}
+
+// Pid returns the process id of the process or -1 if no process was spawned,
+// e.g. in dry-run mode. For a pipeline, the process id of the last stage is returned.
+func (process *Process) Pid() int {
+	return process.builder.Pid()
+}
+
+// Exited reports whether the process has exited
+func (process *Process) Exited() bool {
+	select {
+	case <-process.done:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,32 @@
+//go:build !unix
+
+package builder
+
+import (
+	"errors"
+	"runtime"
+)
+
+// ErrPTYUnsupported is returned when starting a command in PTY mode on an OS
+// that doesn't support pseudo-terminals
+var ErrPTYUnsupported = errors.New("pty is unsupported on " + runtime.GOOS)
+
+// ptyState is unused on systems without pseudo-terminals
+type ptyState struct{}
+
+// PTY is unsupported on Windows and other systems without pseudo-terminals.
+// The command returns ErrPTYUnsupported when started.
+func (cmdBuilder *CmdBuilder) PTY() *CmdBuilder {
+	cmdBuilder.setErr(ErrPTYUnsupported)
+	return cmdBuilder
+}
+
+func (cmdBuilder *CmdBuilder) openPTY() error {
+	return ErrPTYUnsupported
+}
+
+func (cmdBuilder *CmdBuilder) attachPTY() {}
+
+func (cmdBuilder *CmdBuilder) closePTY(started bool) {}
+
+func (cmdBuilder *CmdBuilder) restorePTY() {}
@@ -0,0 +1,34 @@
+//go:build unix
+
+package builder
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPTYStdinString(t *testing.T) {
+	tests := []struct {
+		name  string
+		stdin string
+	}{
+		{name: "complete line", stdin: "hello\n"},
+		{name: "incomplete line", stdin: "hello"},
+		{name: "empty", stdin: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := Cmd("cat").PTY().StdinString(tt.stdin).Timeout(5 * time.Second).Output()
+			if err != nil {
+				t.Fatalf("Output() error = %v", err)
+			}
+			// the terminal echoes the input before cat writes it back
+			got := strings.NewReplacer("\r", "", "\n", "").Replace(output)
+			if want := strings.Repeat(strings.TrimSpace(tt.stdin), 2); got != want {
+				t.Errorf("Output() = %q, want the input echoed and written back", output)
+			}
+		})
+	}
+}
@@ -0,0 +1,305 @@
+//go:build unix
+
+package builder
+
+import (
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/creack/pty"
+	"golang.org/x/sys/unix"
+)
+
+// ptyState holds the pseudo-terminal of a run started in PTY mode
+type ptyState struct {
+	master *os.File
+	slave  *os.File
+	// stdin is the configured stdin, restored once the run completes
+	stdin io.Reader
+	// out is where the output read from the terminal is written
+	out io.Writer
+	// copied is closed once all of the output has been copied from the terminal
+	copied chan struct{}
+	// stopStdin is closed to stop copying a file stdin to the terminal, and
+	// stdinCopied once it stopped
+	stopStdin   *os.File
+	stdinCopied chan struct{}
+	// eof is the terminal's end of file character, written once a stdin that isn't
+	// a file has been copied
+	eof     byte
+	winch   chan os.Signal
+	winchTo *os.File
+	// termState is the state of winchTo before it was put into raw mode
+	termState *unix.Termios
+	restored  sync.Once
+	// signals receives the signals that restore the terminal in raw mode
+	signals chan os.Signal
+}
+
+// rawSignals are the signals that restore the terminal in raw mode before they're
+// forwarded to the command, since they may stop the current process
+var rawSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT}
+
+// PTY runs the command in a pseudo-terminal, for programs that behave differently
+// or refuse to run when they aren't attached to a terminal. The child's stdin,
+// stdout, and stderr are all attached to the terminal. Everything the child writes
+// is copied to the configured stdout, which means the child's stderr is merged into
+// stdout, and the configured stdin is copied to the child. If stdin is a terminal,
+// e.g. in Interactive mode, its size is propagated to the child and kept in sync.
+// A stdin that is a file, like os.Stdin, is no longer read once the command exits,
+// so input meant for the current process isn't lost. Any other reader is read
+// until it returns an error, so one that blocks, e.g. an io.Pipe, may be read
+// once more after the command exits. Once it returns io.EOF the terminal's end of
+// file character is written, so the command reads the end of its input, e.g. the
+// input of StdinString.
+func (cmdBuilder *CmdBuilder) PTY() *CmdBuilder {
+	cmdBuilder.pty = true
+	return cmdBuilder
+}
+
+// openPTY attaches the command to a new pseudo-terminal before it is started
+func (cmdBuilder *CmdBuilder) openPTY() error {
+	master, slave, err := pty.Open()
+	if err != nil {
+		return err
+	}
+
+	state := &ptyState{
+		master: master,
+		slave:  slave,
+		stdin:  cmdBuilder.cmd.Stdin,
+		out:    cmdBuilder.cmd.Stdout,
+		copied: make(chan struct{}),
+		eof:    eofChar(slave),
+	}
+
+	if f, ok := state.stdin.(*os.File); ok {
+		if err := pty.InheritSize(f, master); err == nil {
+			state.winchTo = f
+		}
+	}
+
+	if state.winchTo != nil && cmdBuilder.rawTerminal {
+		termState, err := makeRaw(state.winchTo)
+		if err != nil {
+			master.Close()
+			slave.Close()
+			return err
+		}
+		state.termState = termState
+		state.signals = make(chan os.Signal, 1)
+		signal.Notify(state.signals, rawSignals...)
+	}
+
+	cmdBuilder.cmd.Stdin = slave
+	cmdBuilder.cmd.Stdout = slave
+	cmdBuilder.cmd.Stderr = slave
+
+	attr := cmdBuilder.sysProcAttr()
+	attr.Setsid = true
+	attr.Setctty = true
+	attr.Ctty = 0
+
+	cmdBuilder.state.pty = state
+	return nil
+}
+
+// attachPTY starts copying between the terminal and the configured streams
+// once the command has started
+func (cmdBuilder *CmdBuilder) attachPTY() {
+	state := cmdBuilder.state.pty
+	state.slave.Close()
+
+	go func() {
+		defer close(state.copied)
+		// the output may be written to functions like those of StreamStderr
+		defer func() {
+			if r := recover(); r != nil {
+				state.restore()
+				panic(r)
+			}
+		}()
+
+		out := state.out
+		if out == nil {
+			out = io.Discard
+		}
+		// reading the terminal fails with EIO once the child exits
+		io.Copy(out, state.master)
+	}()
+
+	if f, ok := state.stdin.(*os.File); ok {
+		state.copyStdin(f)
+	} else if state.stdin != nil {
+		state.copyReader(state.stdin)
+	}
+
+	if state.signals != nil {
+		process := cmdBuilder.cmd.Process
+		go func() {
+			for sig := range state.signals {
+				state.restore()
+				if !cmdBuilder.forwards(sig) {
+					process.Signal(sig)
+				}
+			}
+		}()
+	}
+
+	if state.winchTo != nil {
+		state.winch = make(chan os.Signal, 1)
+		signal.Notify(state.winch, syscall.SIGWINCH)
+		go func() {
+			for range state.winch {
+				pty.InheritSize(state.winchTo, state.master)
+			}
+		}()
+	}
+}
+
+// closePTY waits for the output of the exited command to be copied from the
+// terminal and closes it. If the command never started, the terminal is just closed.
+func (cmdBuilder *CmdBuilder) closePTY(started bool) {
+	state := cmdBuilder.state.pty
+	if state == nil {
+		return
+	}
+	cmdBuilder.state.pty = nil
+
+	if started {
+		<-state.copied
+	} else {
+		state.slave.Close()
+	}
+
+	if state.winch != nil {
+		signal.Stop(state.winch)
+		close(state.winch)
+	}
+	if state.signals != nil {
+		signal.Stop(state.signals)
+		close(state.signals)
+	}
+	if state.stopStdin != nil {
+		state.stopStdin.Close()
+		<-state.stdinCopied
+	}
+	state.restore()
+
+	state.master.Close()
+	cmdBuilder.cmd.Stdin = state.stdin
+}
+
+// restorePTY restores the terminal put into raw mode for the run, if any,
+// e.g. when a hook panics
+func (cmdBuilder *CmdBuilder) restorePTY() {
+	if state := cmdBuilder.state.pty; state != nil {
+		state.restore()
+	}
+}
+
+// restore restores the terminal put into raw mode, once
+func (state *ptyState) restore() {
+	if state.termState != nil {
+		state.restored.Do(func() {
+			restoreTerminal(state.winchTo, state.termState)
+		})
+	}
+}
+
+// copyStdin copies the file stdin to the terminal until closePTY stops it. The file
+// is polled, so it isn't read once the copy is stopped, which reading it with
+// io.Copy would do as soon as more input is available, e.g. the next line the
+// user types. If the copy can't be stopped, stdin is copied with io.Copy.
+func (state *ptyState) copyStdin(stdin *os.File) {
+	conn, err := stdin.SyscallConn()
+	if err != nil {
+		state.copyReader(stdin)
+		return
+	}
+	var fd int
+	conn.Control(func(f uintptr) {
+		fd = int(f)
+	})
+
+	stop, stopStdin, err := os.Pipe()
+	if err != nil {
+		state.copyReader(stdin)
+		return
+	}
+	state.stopStdin = stopStdin
+	state.stdinCopied = make(chan struct{})
+
+	go func() {
+		defer close(state.stdinCopied)
+		defer stop.Close()
+
+		fds := []unix.PollFd{
+			{Fd: int32(fd), Events: unix.POLLIN},
+			{Fd: int32(stop.Fd()), Events: unix.POLLIN},
+		}
+		buf := make([]byte, 32*1024)
+		for {
+			if _, err := unix.Poll(fds, -1); err != nil {
+				if err == unix.EINTR {
+					continue
+				}
+				return
+			}
+			// closing the write end of the pipe makes the read end readable
+			if fds[1].Revents != 0 {
+				return
+			}
+			if fds[0].Revents&(unix.POLLIN|unix.POLLHUP) == 0 {
+				return
+			}
+
+			n, err := unix.Read(fd, buf)
+			if err == unix.EAGAIN || err == unix.EINTR {
+				continue
+			}
+			if n <= 0 || err != nil {
+				return
+			}
+			if _, err := state.master.Write(buf[:n]); err != nil {
+				return
+			}
+		}
+	}()
+}
+
+// copyReader copies stdin to the terminal, then writes the terminal's end of file
+// character so the command reads the end of its input. An incomplete last line
+// takes one more, since the first only ends the line.
+func (state *ptyState) copyReader(stdin io.Reader) {
+	go func() {
+		w := &lastByteWriter{w: state.master}
+		if _, err := io.Copy(w, stdin); err != nil {
+			return
+		}
+
+		eof := []byte{state.eof}
+		if w.written && w.last != '\n' {
+			eof = append(eof, state.eof)
+		}
+		state.master.Write(eof)
+	}()
+}
+
+// lastByteWriter writes to w and records the last byte written
+type lastByteWriter struct {
+	w       io.Writer
+	last    byte
+	written bool
+}
+
+func (lw *lastByteWriter) Write(p []byte) (int, error) {
+	n, err := lw.w.Write(p)
+	if n > 0 {
+		lw.last, lw.written = p[n-1], true
+	}
+	return n, err
+}
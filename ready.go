@@ -0,0 +1,74 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotReady is returned by StartReady when the command isn't ready before the timeout
+	ErrNotReady = errors.New("command wasn't ready before the timeout")
+	// ErrExitedBeforeReady is returned by StartReady when the command exits before it's ready
+	ErrExitedBeforeReady = errors.New("command exited before it was ready")
+)
+
+// StartReady starts the command in the background and waits until it writes a
+// line matching re to its stdout or stderr, e.g. "listening on :8080", returning
+// a handle to the running process. If the timeout elapses first the process is
+// killed and ErrNotReady is returned. If the command exits first the returned
+// error wraps ErrExitedBeforeReady and the error it exited with, if any.
+// A timeout of 0 waits until the command is ready or exits. In dry-run mode
+// StartReady returns immediately.
+func (cmdBuilder *CmdBuilder) StartReady(re *regexp.Regexp, timeout time.Duration) (*Process, error) {
+	ready := make(chan struct{})
+	var once sync.Once
+	match := func(line string) {
+		if re.MatchString(line) {
+			once.Do(func() { close(ready) })
+		}
+	}
+
+	// the line functions are only needed for this run, which copies them when it starts
+	stdoutLines, stderrLines := cmdBuilder.stdoutLines, cmdBuilder.stderrLines
+	cmdBuilder.stdoutLines = append(stdoutLines[:len(stdoutLines):len(stdoutLines)], match)
+	cmdBuilder.stderrLines = append(stderrLines[:len(stderrLines):len(stderrLines)], match)
+	process, err := cmdBuilder.Background()
+	cmdBuilder.stdoutLines, cmdBuilder.stderrLines = stdoutLines, stderrLines
+	if err != nil {
+		return nil, err
+	}
+	if cmdBuilder.dryRun != nil {
+		return process, nil
+	}
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case <-ready:
+		return process, nil
+	case <-process.done:
+		// a matching line may have been written just before the command exited
+		select {
+		case <-ready:
+			return process, nil
+		default:
+		}
+
+		if err := process.Wait(); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrExitedBeforeReady, err)
+		}
+		return nil, ErrExitedBeforeReady
+	case <-expired:
+		process.Kill()
+		process.Wait()
+		return nil, ErrNotReady
+	}
+}
@@ -0,0 +1,110 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Retry re-runs the command when it fails until it has been run the specified
+// number of attempts, sleeping for backoff between each attempt.
+// Retries apply to Run, Output, and the other methods that wait for the command to complete.
+// If more than one attempt failed, the returned error joins the error of every
+// attempt with errors.Join, in order, so errors.Is and errors.As inspect all of them.
+func (cmdBuilder *CmdBuilder) Retry(attempts int, backoff time.Duration) *CmdBuilder {
+	return cmdBuilder.RetryFunc(attempts, nil, func(int) time.Duration {
+		return backoff
+	})
+}
+
+// RetryFunc is like Retry but shouldRetry decides whether the error of a failed attempt
+// should be retried and backoff returns how long to sleep after the given attempt,
+// starting at 1. A nil shouldRetry retries every error and a nil backoff doesn't sleep.
+func (cmdBuilder *CmdBuilder) RetryFunc(attempts int, shouldRetry func(err error) bool, backoff func(attempt int) time.Duration) *CmdBuilder {
+	cmdBuilder.attempts = attempts
+	cmdBuilder.shouldRetry = shouldRetry
+	cmdBuilder.backoff = backoff
+	return cmdBuilder
+}
+
+// run runs the command, retrying it if configured to. reset is called before
+// each retry so any captured output from the failed attempt can be discarded.
+func (cmdBuilder *CmdBuilder) run(ctx context.Context, reset func()) error {
+	err := cmdBuilder.runOnce(ctx)
+	var errs []error
+	for attempt := 1; attempt < cmdBuilder.attempts && err != nil; attempt++ {
+		if ctx.Err() != nil || (cmdBuilder.shouldRetry != nil && !cmdBuilder.shouldRetry(err)) {
+			break
+		}
+		// running the command again would produce just as much output
+		var tooLarge *OutputTooLargeError
+		if errors.As(err, &tooLarge) {
+			break
+		}
+
+		errs = append(errs, err)
+		for _, fn := range cmdBuilder.onRetry {
+			fn(attempt, err)
+		}
+
+		if cmdBuilder.backoff != nil {
+			if sleepErr := sleep(ctx, cmdBuilder.backoff(attempt)); sleepErr != nil {
+				break
+			}
+		}
+
+		// an exec.Cmd can't be reused once it has been started
+		for _, stage := range cmdBuilder.stages() {
+			stage.rebuild()
+		}
+		if reset != nil {
+			reset()
+		}
+
+		err = cmdBuilder.runOnce(ctx)
+	}
+
+	if err != nil && len(errs) > 0 {
+		return errors.Join(append(errs, err)...)
+	}
+	return err
+}
+
+// OnRetry registers a hook that is called before the command is retried with
+// the attempt that failed, starting at 1, and its error, e.g. for logging.
+// Hooks are called in the order they were registered.
+func (cmdBuilder *CmdBuilder) OnRetry(fn func(attempt int, err error)) *CmdBuilder {
+	cmdBuilder.onRetry = append(cmdBuilder.onRetry, fn)
+	return cmdBuilder
+}
+
+// lastError returns the error of the last attempt if err joins the errors
+// of every attempt of a retried command, otherwise err
+func lastError(err error) error {
+	if _, ok := err.(*PipelineError); ok {
+		return err
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		if errs := joined.Unwrap(); len(errs) > 0 {
+			return errs[len(errs)-1]
+		}
+	}
+	return err
+}
+
+// sleep sleeps for the duration or until the context is done
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,35 @@
+package builder
+
+import (
+	"fmt"
+	"math"
+)
+
+// RLimInfinity is the value of an unlimited resource limit
+const RLimInfinity uint64 = math.MaxUint64
+
+// rlimit is a resource limit set with RLimit
+type rlimit struct {
+	resource int
+	soft     uint64
+	hard     uint64
+}
+
+// LimitError is returned when a command is killed because it exceeded one of its
+// resource limits, e.g. the limit set with MaxCPUTime
+type LimitError struct {
+	// Resource is the resource whose limit was exceeded, e.g. syscall.RLIMIT_CPU
+	Resource int
+	// Name is the name of the resource, e.g. "cpu time"
+	Name string
+	// Err is the error returned from waiting on the killed command
+	Err error
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("command exceeded its %s limit: %s", e.Name, e.Err)
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
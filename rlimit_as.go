@@ -0,0 +1,15 @@
+//go:build unix && !openbsd
+
+package builder
+
+import "syscall"
+
+func init() {
+	ulimits[syscall.RLIMIT_AS] = ulimitOption{"memory", "-v", 1024}
+}
+
+// MaxMemory limits the virtual memory of the command in bytes. Allocations beyond
+// the limit fail, which most programs report as an out of memory error.
+func (cmdBuilder *CmdBuilder) MaxMemory(bytes uint64) *CmdBuilder {
+	return cmdBuilder.RLimit(syscall.RLIMIT_AS, bytes, bytes)
+}
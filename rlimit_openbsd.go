@@ -0,0 +1,13 @@
+package builder
+
+import "errors"
+
+// ErrMaxMemoryUnsupported is returned when limiting the virtual memory of a command
+// on OpenBSD, which has no RLIMIT_AS
+var ErrMaxMemoryUnsupported = errors.New("virtual memory limits are unsupported on openbsd")
+
+// MaxMemory is unsupported on OpenBSD. The command returns ErrMaxMemoryUnsupported when started.
+func (cmdBuilder *CmdBuilder) MaxMemory(bytes uint64) *CmdBuilder {
+	cmdBuilder.setErr(ErrMaxMemoryUnsupported)
+	return cmdBuilder
+}
@@ -0,0 +1,37 @@
+//go:build !unix
+
+package builder
+
+import (
+	"errors"
+	"runtime"
+	"time"
+)
+
+// ErrRLimitUnsupported is returned when setting the resource limits of a command
+// isn't supported on the current OS
+var ErrRLimitUnsupported = errors.New("resource limits are unsupported on " + runtime.GOOS)
+
+// RLimit is unsupported on Windows and other systems that aren't Unix.
+// The command returns ErrRLimitUnsupported when started.
+func (cmdBuilder *CmdBuilder) RLimit(resource int, soft, hard uint64) *CmdBuilder {
+	cmdBuilder.setErr(ErrRLimitUnsupported)
+	return cmdBuilder
+}
+
+// MaxCPUTime is unsupported on Windows and other systems that aren't Unix.
+// The command returns ErrRLimitUnsupported when started.
+func (cmdBuilder *CmdBuilder) MaxCPUTime(d time.Duration) *CmdBuilder {
+	return cmdBuilder.RLimit(0, 0, 0)
+}
+
+// MaxMemory is unsupported on Windows and other systems that aren't Unix.
+// The command returns ErrRLimitUnsupported when started.
+func (cmdBuilder *CmdBuilder) MaxMemory(bytes uint64) *CmdBuilder {
+	return cmdBuilder.RLimit(0, 0, 0)
+}
+
+// limitError returns err since resource limits are unsupported outside of Unix
+func (cmdBuilder *CmdBuilder) limitError(err error) error {
+	return err
+}
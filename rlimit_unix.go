@@ -0,0 +1,99 @@
+//go:build unix
+
+package builder
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+)
+
+// ulimitOption is the name of a resource, the option of the shell's ulimit builtin
+// that sets it, and the unit of the option
+type ulimitOption struct {
+	name   string
+	option string
+	unit   uint64
+}
+
+// ulimits maps the resources supported by RLimit to their ulimit option.
+// RLIMIT_AS is added on the platforms that have it.
+var ulimits = map[int]ulimitOption{
+	syscall.RLIMIT_CPU:    {"cpu time", "-t", 1},
+	syscall.RLIMIT_DATA:   {"data size", "-d", 1024},
+	syscall.RLIMIT_STACK:  {"stack size", "-s", 1024},
+	syscall.RLIMIT_NOFILE: {"open files", "-n", 1},
+}
+
+// RLimit runs the command with the soft and hard limits of the resource set, like
+// setrlimit(2). The supported resources are syscall.RLIMIT_CPU in seconds,
+// syscall.RLIMIT_AS, except on OpenBSD, RLIMIT_DATA, and RLIMIT_STACK in bytes,
+// and RLIMIT_NOFILE.
+// A limit of RLimInfinity is unlimited. Like Umask, the limits are set by running the
+// command with /bin/sh, so the limits of the current process are unaffected.
+// An unsupported resource returns an error when the command is started.
+func (cmdBuilder *CmdBuilder) RLimit(resource int, soft, hard uint64) *CmdBuilder {
+	if _, ok := ulimits[resource]; !ok {
+		cmdBuilder.setErr(fmt.Errorf("unsupported resource limit %d", resource))
+		return cmdBuilder
+	}
+
+	cmdBuilder.rlimits = append(cmdBuilder.rlimits, rlimit{resource: resource, soft: soft, hard: hard})
+	return cmdBuilder
+}
+
+// MaxCPUTime limits the CPU time the command can use, rounded up to the second.
+// Once it's used the process is sent SIGXCPU, and it's killed a second later.
+// Running the command then returns an error wrapping a *LimitError.
+func (cmdBuilder *CmdBuilder) MaxCPUTime(d time.Duration) *CmdBuilder {
+	seconds := uint64((d + time.Second - 1) / time.Second)
+	return cmdBuilder.RLimit(syscall.RLIMIT_CPU, seconds, seconds+1)
+}
+
+// ulimit returns the shell commands that set the limit
+func (limit rlimit) ulimit() []string {
+	option := ulimits[limit.resource].option
+	if limit.soft == limit.hard {
+		return []string{fmt.Sprintf("ulimit %s %s", option, limit.value(limit.soft))}
+	}
+	// setting the hard limit first keeps the soft limit from exceeding it
+	return []string{
+		fmt.Sprintf("ulimit %s %s", option, limit.value(limit.hard)),
+		fmt.Sprintf("ulimit -S %s %s", option, limit.value(limit.soft)),
+	}
+}
+
+// value formats the limit in the unit of the ulimit option
+func (limit rlimit) value(v uint64) string {
+	if v == RLimInfinity {
+		return "unlimited"
+	}
+	return fmt.Sprint(v / ulimits[limit.resource].unit)
+}
+
+// limitError wraps err in a *LimitError if the process was killed for exceeding
+// its CPU time limit. Exceeding the other limits makes the process fail in ways
+// that can't be told apart from other failures.
+func (cmdBuilder *CmdBuilder) limitError(err error) error {
+	state := cmdBuilder.cmd.ProcessState
+	if state == nil {
+		return err
+	}
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return err
+	}
+
+	for _, limit := range cmdBuilder.rlimits {
+		if limit.resource != syscall.RLIMIT_CPU {
+			continue
+		}
+
+		used := state.UserTime() + state.SystemTime()
+		if status.Signal() == syscall.SIGXCPU ||
+			(status.Signal() == syscall.SIGKILL && limit.soft != RLimInfinity && used >= time.Duration(limit.soft)*time.Second) {
+			return &LimitError{Resource: limit.resource, Name: ulimits[limit.resource].name, Err: err}
+		}
+	}
+	return err
+}
@@ -0,0 +1,25 @@
+package builder
+
+// Runner runs a command. *CmdBuilder is the default implementation; code that
+// shells out can create its commands with a RunnerFunc instead of a factory so
+// tests can substitute a fake that doesn't spawn processes, see the buildertest package.
+type Runner interface {
+	Run() error
+	Output() (string, error)
+	Capture() (RunResult, error)
+	ExitCode() (int, error)
+	Start() error
+	Wait() error
+}
+
+var _ Runner = (*CmdBuilder)(nil)
+
+// RunnerFunc creates the Runner of a command, e.g. CmdFactory.Runner,
+// or buildertest.FakeRunner.Cmd in tests
+type RunnerFunc func(name string, args ...string) Runner
+
+// Runner is like Cmd except it returns the builder as a Runner,
+// so the method value can be used as a RunnerFunc
+func (factory CmdFactory) Runner(name string, args ...string) Runner {
+	return factory.Cmd(name, args...)
+}
@@ -0,0 +1,19 @@
+//go:build !unix
+
+package builder
+
+import (
+	"os"
+	"time"
+)
+
+// terminateSignal is the signal used to ask a process to exit gracefully.
+// Sending os.Interrupt isn't implemented on Windows so the process is killed instead.
+// Systems that aren't Unix have no equivalent to SIGTERM.
+var terminateSignal = os.Interrupt
+
+// terminate kills the process immediately since Windows and the other
+// systems that aren't Unix have no equivalent to SIGTERM
+func terminate(process signaler, grace time.Duration, done <-chan struct{}) {
+	process.Kill()
+}
@@ -0,0 +1,35 @@
+//go:build unix
+
+package builder
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// terminateSignal is the signal used to ask a process to exit gracefully
+var terminateSignal os.Signal = syscall.SIGTERM
+
+// terminate sends SIGTERM to the process and kills it if it hasn't
+// exited by the time the grace period elapses
+func terminate(process signaler, grace time.Duration, done <-chan struct{}) {
+	if grace <= 0 {
+		process.Kill()
+		return
+	}
+
+	if err := process.Signal(terminateSignal); err != nil {
+		process.Kill()
+		return
+	}
+
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		process.Kill()
+	case <-done:
+	}
+}
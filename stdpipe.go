@@ -0,0 +1,143 @@
+package builder
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// ErrPipeConflict is returned when a command whose stdout or stderr is read through
+// StdoutPipe or StderrPipe is started with the stream also written elsewhere, e.g.
+// set to another writer, captured by Output, teed, or piped into the next stage
+var ErrPipeConflict = errors.New("a stream read through a pipe can't be written elsewhere")
+
+// outputPipe is a pipe the output of a command is read through
+type outputPipe struct {
+	r *os.File
+	w *os.File
+	// read is closed once the reader has been read to the end or closed
+	read chan struct{}
+	once sync.Once
+}
+
+// StdoutPipe returns a reader of the command's standard output for the next run.
+// Unlike exec.Cmd.StdoutPipe, waiting on the command is sequenced after the reads:
+// Wait, and the methods that run the command to completion, block until the reader
+// has been read to the end or closed, so the output can't be lost by waiting too early.
+// The output must therefore be read while waiting, or before. The pipe replaces the
+// configured Stdout and is only used by the next run. Starting the command fails with
+// ErrPipeConflict if Stdout is set afterwards or stdout is written anywhere else, e.g.
+// captured by Output or the like, teed, prefixed, streamed by line, or sent to a PTY.
+func (cmdBuilder *CmdBuilder) StdoutPipe() (io.ReadCloser, error) {
+	if cmdBuilder.stdoutPipe != nil {
+		return nil, errors.New("stdout pipe already set")
+	}
+
+	pipe, err := newOutputPipe()
+	if err != nil {
+		return nil, err
+	}
+	cmdBuilder.stdoutPipe = pipe
+	cmdBuilder.cmd.Stdout = pipe.w
+	return pipe, nil
+}
+
+// StderrPipe is like StdoutPipe for the command's standard error. Starting the
+// command fails with ErrPipeConflict if Stderr is set afterwards, stderr is
+// written anywhere else, or MergeStderr is set.
+func (cmdBuilder *CmdBuilder) StderrPipe() (io.ReadCloser, error) {
+	if cmdBuilder.stderrPipe != nil {
+		return nil, errors.New("stderr pipe already set")
+	}
+
+	pipe, err := newOutputPipe()
+	if err != nil {
+		return nil, err
+	}
+	cmdBuilder.stderrPipe = pipe
+	cmdBuilder.cmd.Stderr = pipe.w
+	return pipe, nil
+}
+
+func newOutputPipe() (*outputPipe, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	return &outputPipe{r: r, w: w, read: make(chan struct{})}, nil
+}
+
+func (pipe *outputPipe) Read(p []byte) (int, error) {
+	n, err := pipe.r.Read(p)
+	if err != nil {
+		pipe.done()
+	}
+	return n, err
+}
+
+// Close closes the reader, so waiting on the command no longer waits for the
+// output to be read. Writing more output fails the command.
+func (pipe *outputPipe) Close() error {
+	err := pipe.r.Close()
+	pipe.done()
+	return err
+}
+
+func (pipe *outputPipe) done() {
+	pipe.once.Do(func() {
+		close(pipe.read)
+	})
+}
+
+// checkPipes returns ErrPipeConflict if the output read through a pipe would
+// also be written elsewhere
+func (cmdBuilder *CmdBuilder) checkPipes() error {
+	// the pipes are passed to the process as they are, since copying to them would
+	// only end once the command is waited on, which waits for them to be read
+	wrapped := cmdBuilder.prefix != "" || cmdBuilder.pty
+	if pipe := cmdBuilder.stdoutPipe; pipe != nil {
+		if cmdBuilder.cmd.Stdout != pipe.w || cmdBuilder.captureStdout != nil || cmdBuilder.piped ||
+			len(cmdBuilder.teeStdout) > 0 || len(cmdBuilder.stdoutLines) > 0 || wrapped {
+			return ErrPipeConflict
+		}
+	}
+	if pipe := cmdBuilder.stderrPipe; pipe != nil {
+		if cmdBuilder.cmd.Stderr != pipe.w || cmdBuilder.captureStderr != nil || cmdBuilder.mergeStderr ||
+			len(cmdBuilder.teeStderr) > 0 || len(cmdBuilder.stderrLines) > 0 || wrapped {
+			return ErrPipeConflict
+		}
+	}
+	return nil
+}
+
+// closePipes closes the write ends of the pipes once the command has started,
+// or failed to, so the readers see the end of the output once the command exits
+func (cmdBuilder *CmdBuilder) closePipes() {
+	for _, pipe := range []*outputPipe{cmdBuilder.stdoutPipe, cmdBuilder.stderrPipe} {
+		if pipe != nil {
+			pipe.w.Close()
+		}
+	}
+}
+
+// awaitPipes waits for the output of the pipes to be read before the command is waited on
+func (cmdBuilder *CmdBuilder) awaitPipes() {
+	for _, pipe := range []*outputPipe{cmdBuilder.stdoutPipe, cmdBuilder.stderrPipe} {
+		if pipe != nil {
+			<-pipe.read
+		}
+	}
+}
+
+// releasePipes detaches the pipes used by the run from the command
+func (cmdBuilder *CmdBuilder) releasePipes() {
+	if cmdBuilder.stdoutPipe != nil {
+		cmdBuilder.cmd.Stdout = nil
+		cmdBuilder.stdoutPipe = nil
+	}
+	if cmdBuilder.stderrPipe != nil {
+		cmdBuilder.cmd.Stderr = nil
+		cmdBuilder.stderrPipe = nil
+	}
+}
@@ -0,0 +1,150 @@
+package builder
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"math"
+)
+
+// StreamLines runs the command and calls fn with each line of its standard output
+// as it is written. Lines are not limited in length. If Stdout is already specified
+// the output is written to it as well.
+func (cmdBuilder *CmdBuilder) StreamLines(fn func(line string)) error {
+	return cmdBuilder.StreamLinesContext(cmdBuilder.context(), fn)
+}
+
+// StreamLinesContext is like StreamLines but binds the command to the provided context.
+func (cmdBuilder *CmdBuilder) StreamLinesContext(ctx context.Context, fn func(line string)) error {
+	pr, pw := io.Pipe()
+
+	scanErr := make(chan error, 1)
+	go func() {
+		scanErr <- scanTokens(pr, cmdBuilder.split, fn)
+	}()
+
+	err := cmdBuilder.capture(pw, nil, func() error {
+		return cmdBuilder.run(ctx, nil)
+	})
+	pw.Close()
+
+	if serr := <-scanErr; err == nil {
+		err = serr
+	}
+	return err
+}
+
+// CombinedReader starts the command and returns a reader of its combined standard
+// output and standard error, in the order they were written, e.g. for a parser
+// that reads from an io.Reader. The reader returns io.EOF once the command has
+// exited and all of its output has been read. Closing the reader waits for the
+// command and returns its error; if the output wasn't read to the end, writing
+// more of it fails the command. If Stdout or Stderr are already specified the
+// output is written to them as well.
+func (cmdBuilder *CmdBuilder) CombinedReader() (io.ReadCloser, error) {
+	pr, pw := io.Pipe()
+	if err := cmdBuilder.capture(pw, pw, cmdBuilder.Start); err != nil {
+		pw.Close()
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		err := cmdBuilder.Wait()
+		pw.Close()
+		done <- err
+	}()
+
+	return &combinedReader{PipeReader: pr, done: done}, nil
+}
+
+// combinedReader reads the output of a command started by CombinedReader
+type combinedReader struct {
+	*io.PipeReader
+	done chan error
+	err  error
+}
+
+// Close closes the reader and waits for the command
+func (r *combinedReader) Close() error {
+	r.PipeReader.Close()
+	if r.done != nil {
+		r.err = <-r.done
+		r.done = nil
+	}
+	return r.err
+}
+
+// StreamStderr calls fn with each line of the command's standard error as it is
+// written, e.g. to detect a log line. The stderr is still written to the configured
+// Stderr and captured by Output and the like. Lines are passed without the line
+// ending. If MergeStderr is set, fn receives nothing.
+func (cmdBuilder *CmdBuilder) StreamStderr(fn func(line string)) *CmdBuilder {
+	cmdBuilder.stderrLines = append(cmdBuilder.stderrLines, fn)
+	return cmdBuilder
+}
+
+// LogTo writes each line of the command's stdout and stderr to the logger as
+// its own entry as it is written. The logger serializes its writes, so the lines
+// of commands logging to the same logger concurrently don't interleave. The output
+// is still written to the configured Stdout and Stderr. See LogToLevels.
+func (cmdBuilder *CmdBuilder) LogTo(logger *log.Logger) *CmdBuilder {
+	return cmdBuilder.LogToLevels(logger, "", "")
+}
+
+// LogToLevels is like LogTo except the lines of stdout and stderr are prefixed
+// with the levels, e.g. "INFO " and "ERROR ". If MergeStderr is set, every line
+// is logged with the stdout level.
+func (cmdBuilder *CmdBuilder) LogToLevels(logger *log.Logger, stdoutLevel, stderrLevel string) *CmdBuilder {
+	cmdBuilder.stdoutLines = append(cmdBuilder.stdoutLines, func(line string) {
+		logger.Print(stdoutLevel + line)
+	})
+	return cmdBuilder.StreamStderr(func(line string) {
+		logger.Print(stderrLevel + line)
+	})
+}
+
+// Split splits the output of the command into lines with the split function
+// instead of by new lines, e.g. bufio.ScanWords. It affects Lines, CombinedLines,
+// and the lines passed to StreamLines and StreamStderr.
+func (cmdBuilder *CmdBuilder) Split(split bufio.SplitFunc) *CmdBuilder {
+	cmdBuilder.split = split
+	return cmdBuilder
+}
+
+// NullDelimited splits the output of the command into lines by NUL characters,
+// e.g. for the output of 'find -print0' and 'git ls-files -z'. See Split.
+func (cmdBuilder *CmdBuilder) NullDelimited() *CmdBuilder {
+	return cmdBuilder.Split(scanNull)
+}
+
+// scanNull is a bufio.SplitFunc that splits on NUL characters
+func scanNull(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// scanTokens calls fn with each token read from r, split by split or by new lines
+// if split is nil, until r is closed. r is always drained so writers to it never block.
+func scanTokens(r io.Reader, split bufio.SplitFunc, fn func(line string)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), math.MaxInt32)
+	if split != nil {
+		scanner.Split(split)
+	}
+
+	for scanner.Scan() {
+		fn(scanner.Text())
+	}
+
+	err := scanner.Err()
+	io.Copy(io.Discard, r)
+	return err
+}
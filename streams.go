@@ -0,0 +1,463 @@
+package builder
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"sync"
+)
+
+// wrapStreams sets the command's stdout and stderr to the writers used for the run,
+// combining the configured writers with the tee, capture, and decorating writers
+// the builder adds. The configured streams are restored by restoreStreams.
+func (cmdBuilder *CmdBuilder) wrapStreams() {
+	stdout, stderr := cmdBuilder.cmd.Stdout, cmdBuilder.cmd.Stderr
+	cmdBuilder.state.stdout = stdout
+	cmdBuilder.state.stderr = stderr
+	cmdBuilder.state.wrapped = true
+
+	captureStdout, captureStderr := cmdBuilder.captureStdout, cmdBuilder.captureStderr
+	// combined output is captured from a single pipe like MergeStderr, otherwise
+	// the order of the streams is lost
+	combined := captureStdout != nil && sameWriter(captureStdout, captureStderr)
+	stdoutLines, stderrLines := cmdBuilder.stdoutLines, cmdBuilder.stderrLines
+	// the pipes are passed to the process as they are, see checkPipes
+	if cmdBuilder.stdoutEvent != nil && cmdBuilder.stdoutPipe == nil {
+		stdoutLines = append(stdoutLines[:len(stdoutLines):len(stdoutLines)], cmdBuilder.stdoutEvent)
+	}
+	if cmdBuilder.stderrEvent != nil && cmdBuilder.stderrPipe == nil {
+		stderrLines = append(stderrLines[:len(stderrLines):len(stderrLines)], cmdBuilder.stderrEvent)
+	}
+	if len(stdoutLines) > 0 {
+		cmdBuilder.state.stdoutLines = &lineWriter{fns: stdoutLines, split: cmdBuilder.splitFunc()}
+		captureStdout = multiWriter(captureStdout, cmdBuilder.state.stdoutLines)
+	}
+	if len(stderrLines) > 0 {
+		cmdBuilder.state.stderrLines = &lineWriter{fns: stderrLines, split: cmdBuilder.splitFunc()}
+		captureStderr = multiWriter(captureStderr, cmdBuilder.state.stderrLines)
+	}
+
+	// a piped stdout carries data for the next stage so it is never decorated
+	if cmdBuilder.piped {
+		cmdBuilder.cmd.Stdout = multiWriter(stdout, cmdBuilder.outputWriter(nil, cmdBuilder.teeStdout, captureStdout))
+	} else {
+		cmdBuilder.cmd.Stdout = cmdBuilder.outputWriter(stdout, cmdBuilder.teeStdout, captureStdout)
+	}
+
+	switch {
+	case cmdBuilder.mergeStderr, combined && !cmdBuilder.piped:
+		cmdBuilder.cmd.Stderr = cmdBuilder.cmd.Stdout
+	case !cmdBuilder.piped && sameWriter(stdout, stderr) && sameWriter(captureStdout, captureStderr) &&
+		len(cmdBuilder.teeStdout) == 0 && len(cmdBuilder.teeStderr) == 0:
+		// sharing the writer lets exec use a single pipe, which preserves the order of the output
+		cmdBuilder.cmd.Stderr = cmdBuilder.cmd.Stdout
+	default:
+		cmdBuilder.cmd.Stderr = cmdBuilder.outputWriter(stderr, cmdBuilder.teeStderr, captureStderr)
+	}
+}
+
+// restoreStreams restores the streams wrapped by wrapStreams. If the command ran,
+// any incomplete last line written to the line writers is flushed.
+func (cmdBuilder *CmdBuilder) restoreStreams(ran bool) {
+	if !cmdBuilder.state.wrapped {
+		return
+	}
+
+	// the decoders write what they buffered to the line writers
+	cmdBuilder.closeDecoders(ran)
+	for _, pw := range cmdBuilder.state.prefixWriters {
+		if ran {
+			pw.flush()
+		}
+	}
+	cmdBuilder.state.prefixWriters = nil
+	for _, lw := range []*lineWriter{cmdBuilder.state.stdoutLines, cmdBuilder.state.stderrLines} {
+		if ran && lw != nil {
+			lw.flush()
+		}
+	}
+	cmdBuilder.state.stdoutLines, cmdBuilder.state.stderrLines = nil, nil
+
+	cmdBuilder.cmd.Stdout = cmdBuilder.state.stdout
+	cmdBuilder.cmd.Stderr = cmdBuilder.state.stderr
+	cmdBuilder.state.wrapped = false
+}
+
+// outputWriter returns the writer for one of the command's output streams
+// that writes to the configured writer and tees, decorated with any configured
+// prefix, and to the capture writer. The tees and capture writer are filtered
+// according to the builder's options, and the capture writer decoded. Any of the writers may be nil.
+func (cmdBuilder *CmdBuilder) outputWriter(configured io.Writer, tees []io.Writer, capture io.Writer) io.Writer {
+	var writers []io.Writer
+	if configured != nil {
+		writers = append(writers, cmdBuilder.decorate(configured))
+	}
+	for _, tee := range tees {
+		writers = append(writers, cmdBuilder.decorate(cmdBuilder.filter(tee)))
+	}
+	if capture != nil {
+		writers = append(writers, cmdBuilder.decoder(cmdBuilder.filter(capture)))
+	}
+
+	return multiWriter(nil, writers...)
+}
+
+// filter wraps a tee or capture writer with the builder's filtering options
+func (cmdBuilder *CmdBuilder) filter(w io.Writer) io.Writer {
+	if cmdBuilder.stripANSI {
+		w = &ansiWriter{w: w}
+	}
+	return w
+}
+
+// decorate wraps a configured output writer with the builder's output options
+func (cmdBuilder *CmdBuilder) decorate(w io.Writer) io.Writer {
+	if cmdBuilder.prefix != "" {
+		pw := &prefixWriter{w: w, prefix: []byte(cmdBuilder.prefix)}
+		cmdBuilder.state.prefixWriters = append(cmdBuilder.state.prefixWriters, pw)
+		w = pw
+	}
+	return w
+}
+
+// capture captures stdout and stderr into the writers, in addition to the configured
+// writers, while fn runs the command. Either writer may be nil.
+func (cmdBuilder *CmdBuilder) capture(stdout, stderr io.Writer, fn func() error) error {
+	cmdBuilder.captureStdout, cmdBuilder.captureStderr = stdout, stderr
+	defer func() {
+		cmdBuilder.captureStdout, cmdBuilder.captureStderr = nil, nil
+	}()
+	return fn()
+}
+
+// outputLimiter limits the output captured into the buffers of a run to the
+// builder's MaxOutput and Tail. The buffers it wraps may be written to concurrently.
+type outputLimiter struct {
+	mu      sync.Mutex
+	builder *CmdBuilder
+}
+
+// limiter returns an outputLimiter for the builder
+func (cmdBuilder *CmdBuilder) limiter() *outputLimiter {
+	return &outputLimiter{builder: cmdBuilder}
+}
+
+// limit wraps a capture buffer so it only keeps the builder's Tail lines and
+// at most the builder's MaxOutput bytes are written to it
+func (l *outputLimiter) limit(buf *bytes.Buffer) io.Writer {
+	var w io.Writer = buf
+	if l.builder.tail > 0 {
+		w = &tailWriter{buf: buf, lines: l.builder.tail}
+	}
+
+	if l.builder.maxOutput <= 0 {
+		return w
+	}
+	return &limitWriter{w: w, buf: buf, limiter: l}
+}
+
+// limitWriter writes to w, which writes to buf, until buf holds more than the
+// builder's MaxOutput, then kills the command and records an *OutputTooLargeError.
+// Anything written after the limit is discarded so the command's output keeps
+// being drained until it exits.
+type limitWriter struct {
+	w       io.Writer
+	buf     *bytes.Buffer
+	limiter *outputLimiter
+}
+
+func (lw *limitWriter) Write(p []byte) (int, error) {
+	lw.limiter.mu.Lock()
+	defer lw.limiter.mu.Unlock()
+
+	builder := lw.limiter.builder
+	if builder.state.outputErr != nil {
+		return len(p), nil
+	}
+
+	n, err := lw.w.Write(p)
+	if limit := builder.maxOutput; int64(lw.buf.Len()) > limit {
+		lw.buf.Truncate(int(limit))
+		builder.state.outputErr = &OutputTooLargeError{
+			Limit:  limit,
+			Output: append([]byte(nil), lw.buf.Bytes()...),
+		}
+		builder.kill()
+		return len(p), nil
+	}
+	return n, err
+}
+
+// tailWriter writes to buf, discarding the oldest lines so buf holds at most the
+// given number of lines. An incomplete last line counts as a line.
+type tailWriter struct {
+	buf   *bytes.Buffer
+	lines int
+	// newlines is the number of new lines in buf
+	newlines int
+}
+
+func (tw *tailWriter) Write(p []byte) (int, error) {
+	// the buffer is reset before a retry
+	if tw.buf.Len() == 0 {
+		tw.newlines = 0
+	}
+
+	tw.buf.Write(p)
+	tw.newlines += bytes.Count(p, []byte{'\n'})
+	for tw.count() > tw.lines {
+		tw.buf.Next(bytes.IndexByte(tw.buf.Bytes(), '\n') + 1)
+		tw.newlines--
+	}
+	return len(p), nil
+}
+
+// count returns the number of lines in buf
+func (tw *tailWriter) count() int {
+	b := tw.buf.Bytes()
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		return tw.newlines + 1
+	}
+	return tw.newlines
+}
+
+// multiWriter returns a writer that writes to w and every writer in tees,
+// skipping any nil writers. If every writer is nil, nil is returned.
+func multiWriter(w io.Writer, tees ...io.Writer) io.Writer {
+	var writers []io.Writer
+	for _, writer := range append([]io.Writer{w}, tees...) {
+		if writer != nil {
+			writers = append(writers, writer)
+		}
+	}
+
+	switch len(writers) {
+	case 0:
+		return nil
+	case 1:
+		return writers[0]
+	}
+	return io.MultiWriter(writers...)
+}
+
+// sameWriter reports whether a and b are the same writer.
+// Writers that can't be compared are never the same.
+func sameWriter(a, b io.Writer) (same bool) {
+	defer func() {
+		if recover() != nil {
+			same = false
+		}
+	}()
+	return a == b
+}
+
+// SyncWriter is an io.Writer that serializes writes to the underlying writer so
+// it can be shared by commands running concurrently. Every write is passed to the
+// underlying writer as a whole, so output is never interleaved mid-write.
+type SyncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewSyncWriter returns a SyncWriter that writes to w
+func NewSyncWriter(w io.Writer) *SyncWriter {
+	return &SyncWriter{w: w}
+}
+
+func (sw *SyncWriter) Write(p []byte) (int, error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.w.Write(p)
+}
+
+// syncStream wraps w in a SyncWriter unless it already is one
+func syncStream(w io.Writer) io.Writer {
+	if sw, ok := w.(*SyncWriter); ok {
+		return sw
+	}
+	return NewSyncWriter(w)
+}
+
+// maxPrefixLine is the length of the incomplete line a prefixWriter buffers
+// before writing it as is
+const maxPrefixLine = 64 * 1024
+
+// prefixWriter writes the prefix at the start of every line written to w. Each line
+// is written with its prefix in a single write once it's complete, so the lines of
+// writers sharing a SyncWriter don't interleave.
+type prefixWriter struct {
+	w      io.Writer
+	prefix []byte
+	// line is the incomplete line written so far
+	line []byte
+	// midLine is true if the start of the incomplete line was already written
+	midLine bool
+}
+
+func (pw *prefixWriter) Write(p []byte) (int, error) {
+	for rest := p; len(rest) > 0; {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			pw.line = append(pw.line, rest...)
+			if len(pw.line) >= maxPrefixLine {
+				if err := pw.flush(); err != nil {
+					return len(p), err
+				}
+				pw.midLine = true
+			}
+			break
+		}
+
+		pw.line = append(pw.line, rest[:i+1]...)
+		rest = rest[i+1:]
+		if err := pw.flush(); err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+// flush writes the buffered line, prefixed unless its start was already written
+func (pw *prefixWriter) flush() error {
+	if len(pw.line) == 0 {
+		return nil
+	}
+
+	out := pw.line
+	if !pw.midLine {
+		out = append(append(make([]byte, 0, len(pw.prefix)+len(pw.line)), pw.prefix...), pw.line...)
+	}
+	pw.line, pw.midLine = pw.line[:0], false
+	_, err := pw.w.Write(out)
+	return err
+}
+
+// splitFunc returns the builder's split function, which defaults to splitting by new lines
+func (cmdBuilder *CmdBuilder) splitFunc() bufio.SplitFunc {
+	if cmdBuilder.split == nil {
+		return bufio.ScanLines
+	}
+	return cmdBuilder.split
+}
+
+// lineWriter calls each of fns with every line written to it, as split by split
+type lineWriter struct {
+	fns   []func(line string)
+	split bufio.SplitFunc
+	// buf holds the incomplete line at the end of the last write
+	buf []byte
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.buf = append(lw.buf, p...)
+	lw.scan(false)
+	return len(p), nil
+}
+
+// flush emits the incomplete line, if any
+func (lw *lineWriter) flush() {
+	lw.scan(true)
+	lw.buf = nil
+}
+
+// scan emits every complete line in buf. At EOF the incomplete line is complete.
+func (lw *lineWriter) scan(atEOF bool) {
+	for len(lw.buf) > 0 {
+		advance, token, err := lw.split(lw.buf, atEOF)
+		if err != nil {
+			if err == bufio.ErrFinalToken && token != nil {
+				lw.emit(token)
+			}
+			lw.buf = nil
+			return
+		}
+		if advance == 0 {
+			return
+		}
+
+		if token != nil {
+			lw.emit(token)
+		}
+		lw.buf = lw.buf[advance:]
+	}
+}
+
+func (lw *lineWriter) emit(line []byte) {
+	for _, fn := range lw.fns {
+		fn(string(line))
+	}
+}
+
+// ansiState is the state of an ansiWriter within an escape sequence
+type ansiState int
+
+const (
+	ansiText ansiState = iota
+	// ansiEscape follows an ESC
+	ansiEscape
+	// ansiIntermediate follows an ESC and intermediate bytes, e.g. ESC (
+	ansiIntermediate
+	// ansiCSI is within a control sequence, e.g. ESC [ 31 m
+	ansiCSI
+	// ansiOSC is within an operating system command, e.g. ESC ] 0 ; title BEL
+	ansiOSC
+	// ansiOSCEscape follows an ESC within an operating system command
+	ansiOSCEscape
+)
+
+// ansiWriter removes ANSI escape sequences from the bytes written to w.
+// The state is kept across writes so sequences split between writes are removed.
+type ansiWriter struct {
+	w     io.Writer
+	state ansiState
+	buf   []byte
+}
+
+func (aw *ansiWriter) Write(p []byte) (int, error) {
+	aw.buf = aw.buf[:0]
+	for _, b := range p {
+		switch aw.state {
+		case ansiText:
+			if b == 0x1b {
+				aw.state = ansiEscape
+			} else {
+				aw.buf = append(aw.buf, b)
+			}
+		case ansiEscape:
+			switch {
+			case b == '[':
+				aw.state = ansiCSI
+			case b == ']':
+				aw.state = ansiOSC
+			case b >= 0x20 && b <= 0x2f:
+				aw.state = ansiIntermediate
+			default:
+				aw.state = ansiText
+			}
+		case ansiIntermediate:
+			if b < 0x20 || b > 0x2f {
+				aw.state = ansiText
+			}
+		case ansiCSI:
+			if b >= 0x40 && b <= 0x7e {
+				aw.state = ansiText
+			}
+		case ansiOSC:
+			switch b {
+			case 0x07:
+				aw.state = ansiText
+			case 0x1b:
+				aw.state = ansiOSCEscape
+			}
+		case ansiOSCEscape:
+			aw.state = ansiText
+		}
+	}
+
+	if len(aw.buf) > 0 {
+		if _, err := aw.w.Write(aw.buf); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
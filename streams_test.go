@@ -0,0 +1,78 @@
+//go:build unix
+
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSyncStreamsPrefixOutput(t *testing.T) {
+	const lines = 500
+	var out bytes.Buffer
+	factory := NewFactory(CmdFactoryOptions{
+		Stdout:      &out,
+		Stderr:      &out,
+		SyncStreams: true,
+	})
+
+	script := fmt.Sprintf(`i=0; while [ $i -lt %d ]; do echo "out $i"; echo "err $i" >&2; i=$((i+1)); done`, lines)
+	prefixes := []string{"a: ", "b: ", "c: ", "d: "}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(prefixes))
+	for i, prefix := range prefixes {
+		wg.Add(1)
+		go func(i int, prefix string) {
+			defer wg.Done()
+			errs[i] = factory.Cmd("sh", "-c", script).PrefixOutput(prefix).Run()
+		}(i, prefix)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("command %q: %v", prefixes[i], err)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		if seen[line] {
+			t.Fatalf("line %q was written twice", line)
+		}
+		seen[line] = true
+	}
+	for _, prefix := range prefixes {
+		for i := 0; i < lines; i++ {
+			for _, stream := range []string{"out", "err"} {
+				if line := fmt.Sprintf("%s%s %d", prefix, stream, i); !seen[line] {
+					t.Fatalf("line %q is missing or interleaved with another", line)
+				}
+			}
+		}
+	}
+	if want := len(prefixes) * lines * 2; len(seen) != want {
+		t.Errorf("got %d lines, want %d", len(seen), want)
+	}
+}
+
+func TestCombinedOutputOrder(t *testing.T) {
+	var stdout bytes.Buffer
+	for i := 0; i < 50; i++ {
+		stdout.Reset()
+		output, err := Cmd("sh", "-c", "echo a; echo b >&2; echo c").Stdout(&stdout).CombinedOutput()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "a\nb\nc"; output != want {
+			t.Fatalf("CombinedOutput() = %q, want %q", output, want)
+		}
+		if want := "a\nb\nc\n"; stdout.String() != want {
+			t.Fatalf("configured stdout = %q, want %q", stdout.String(), want)
+		}
+	}
+}
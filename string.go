@@ -0,0 +1,91 @@
+package builder
+
+import (
+	"os"
+	"strings"
+)
+
+// String returns a shell-like representation of the command that can be copied
+// and pasted into a shell, e.g. "cd /tmp && FOO=bar mybin --flag arg".
+// Only environment variables added on top of the current process's environment
+// are included. The stages of a pipeline are separated by '|'.
+func (cmdBuilder *CmdBuilder) String() string {
+	var stages []string
+	for _, stage := range cmdBuilder.stages() {
+		stages = append(stages, stage.commandLine())
+	}
+
+	return strings.Join(stages, " | ")
+}
+
+// commandLine renders the command of a single stage
+func (cmdBuilder *CmdBuilder) commandLine() string {
+	var parts []string
+	if cmdBuilder.cmd.Dir != "" {
+		parts = append(parts, "cd", shellQuote(cmdBuilder.cmd.Dir), "&&")
+	}
+
+	inherited := make(map[string]bool)
+	for _, env := range os.Environ() {
+		inherited[env] = true
+	}
+
+	for _, env := range dedupEnv(cmdBuilder.cmd.Env) {
+		if inherited[env] {
+			continue
+		}
+
+		i := strings.Index(env, "=")
+		if i < 0 {
+			parts = append(parts, shellQuote(env))
+			continue
+		}
+		parts = append(parts, env[:i+1]+shellQuote(cmdBuilder.maskValue(env[:i], env[i+1:])))
+	}
+
+	parts = append(parts, shellQuote(cmdBuilder.name))
+	for _, arg := range cmdBuilder.args()[1:] {
+		parts = append(parts, shellQuote(cmdBuilder.maskArg(arg)))
+	}
+
+	if fs, ok := cmdBuilder.cmd.Stdin.(*fileStream); ok {
+		parts = append(parts, fs.redirect("<"))
+	}
+	if fs, ok := cmdBuilder.cmd.Stdout.(*fileStream); ok {
+		parts = append(parts, fs.redirect(">"))
+	}
+	if fs, ok := cmdBuilder.cmd.Stderr.(*fileStream); ok {
+		parts = append(parts, fs.redirect("2>"))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// shellQuote single quotes s if it contains any characters
+// that have a special meaning to the shell
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+
+	safe := true
+	for _, r := range s {
+		if !isShellSafe(r) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func isShellSafe(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return true
+	}
+	return strings.ContainsRune("_-+=@%:,./", r)
+}
@@ -0,0 +1,36 @@
+//go:build !unix && !windows
+
+package builder
+
+import "os"
+
+// NewProcessGroup is a no-op on systems that are neither Unix nor Windows, and
+// Process.KillGroup only kills the process itself
+func (cmdBuilder *CmdBuilder) NewProcessGroup() *CmdBuilder {
+	return cmdBuilder
+}
+
+// killGroup kills the process since process groups are unsupported
+func killGroup(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Kill()
+}
+
+// rawCmdLine is a no-op since only Windows passes a command line to the process
+func (cmdBuilder *CmdBuilder) rawCmdLine(args string) {}
+
+// Detach connects the command's stdin, stdout, and stderr to os.DevNull unless
+// they are explicitly configured. The process can't be started in a new session
+// on systems that are neither Unix nor Windows.
+func (cmdBuilder *CmdBuilder) Detach() *CmdBuilder {
+	cmdBuilder.detachStreams()
+	return cmdBuilder
+}
+
+// HideWindow is a no-op since only Windows creates a console window for the process
+func (cmdBuilder *CmdBuilder) HideWindow() *CmdBuilder {
+	return cmdBuilder
+}
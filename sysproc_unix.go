@@ -0,0 +1,75 @@
+//go:build unix
+
+package builder
+
+import (
+	"os"
+	"syscall"
+)
+
+// NewProcessGroup starts the command in a new process group so the command
+// and all of its children can be signaled together, e.g. with Process.KillGroup.
+func (cmdBuilder *CmdBuilder) NewProcessGroup() *CmdBuilder {
+	cmdBuilder.sysProcAttr().Setpgid = true
+	return cmdBuilder
+}
+
+// killGroup kills every process in the process group led by pid
+func killGroup(pid int) error {
+	return syscall.Kill(-pid, syscall.SIGKILL)
+}
+
+// startProcessTree starts the command in a new process group, unless it's started
+// in a new session, whose process group is already new
+func (cmdBuilder *CmdBuilder) startProcessTree() {
+	if attr := cmdBuilder.sysProcAttr(); !attr.Setsid {
+		attr.Setpgid = true
+		attr.Pgid = 0
+	}
+}
+
+// treeState is unused since the process group is set up when the process is created
+type treeState struct{}
+
+func (cmdBuilder *CmdBuilder) attachProcessTree() {}
+
+func (cmdBuilder *CmdBuilder) closeProcessTree() {}
+
+// processGroup is the process group led by the process with its id
+type processGroup int
+
+// processTree returns the process group of the started process
+func (cmdBuilder *CmdBuilder) processTree() signaler {
+	return processGroup(cmdBuilder.cmd.Process.Pid)
+}
+
+func (group processGroup) Signal(sig os.Signal) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return os.ErrInvalid
+	}
+	return syscall.Kill(-int(group), s)
+}
+
+func (group processGroup) Kill() error {
+	return killGroup(int(group))
+}
+
+// rawCmdLine is a no-op since only Windows passes a command line to the process
+func (cmdBuilder *CmdBuilder) rawCmdLine(args string) {}
+
+// Detach starts the command as a daemon that keeps running after the current process
+// exits. The command is started in a new session with setsid, detaching it from the
+// controlling terminal. Unless stdin, stdout, or stderr are explicitly configured they
+// are connected to os.DevNull; writers that aren't files are copied by the current
+// process and stop receiving output once it exits.
+func (cmdBuilder *CmdBuilder) Detach() *CmdBuilder {
+	cmdBuilder.sysProcAttr().Setsid = true
+	cmdBuilder.detachStreams()
+	return cmdBuilder
+}
+
+// HideWindow is a no-op since only Windows creates a console window for the process
+func (cmdBuilder *CmdBuilder) HideWindow() *CmdBuilder {
+	return cmdBuilder
+}
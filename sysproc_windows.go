@@ -0,0 +1,60 @@
+//go:build windows
+
+package builder
+
+import (
+	"os"
+	"syscall"
+)
+
+// NewProcessGroup starts the command in a new process group using the
+// CREATE_NEW_PROCESS_GROUP creation flag.
+//
+// On Windows a process group only affects console control events and can't be
+// killed as a whole, so Process.KillGroup only kills the process itself.
+func (cmdBuilder *CmdBuilder) NewProcessGroup() *CmdBuilder {
+	cmdBuilder.sysProcAttr().CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+	return cmdBuilder
+}
+
+// killGroup kills the process since Windows can't kill a process group
+func killGroup(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Kill()
+}
+
+// rawCmdLine sets the command line of the process to the program followed by args,
+// which are passed verbatim instead of being quoted
+func (cmdBuilder *CmdBuilder) rawCmdLine(args string) {
+	cmdBuilder.sysProcAttr().CmdLine = syscall.EscapeArg(cmdBuilder.cmd.Args[0]) + " " + args
+}
+
+// detachedProcess is the DETACHED_PROCESS creation flag
+const detachedProcess = 0x00000008
+
+// Detach starts the command as a daemon that keeps running after the current process
+// exits, using the DETACHED_PROCESS and CREATE_NEW_PROCESS_GROUP creation flags.
+// Unless stdin, stdout, or stderr are explicitly configured they are connected to
+// os.DevNull; writers that aren't files are copied by the current process and stop
+// receiving output once it exits.
+func (cmdBuilder *CmdBuilder) Detach() *CmdBuilder {
+	cmdBuilder.sysProcAttr().CreationFlags |= detachedProcess | syscall.CREATE_NEW_PROCESS_GROUP
+	cmdBuilder.detachStreams()
+	return cmdBuilder
+}
+
+// createNoWindow is the CREATE_NO_WINDOW creation flag
+const createNoWindow = 0x08000000
+
+// HideWindow keeps the command from flashing a console window, e.g. when the current
+// process is a GUI app. The process is started without a console using the
+// CREATE_NO_WINDOW creation flag and its window is hidden with SysProcAttr.HideWindow.
+func (cmdBuilder *CmdBuilder) HideWindow() *CmdBuilder {
+	attr := cmdBuilder.sysProcAttr()
+	attr.HideWindow = true
+	attr.CreationFlags |= createNoWindow
+	return cmdBuilder
+}
@@ -0,0 +1,110 @@
+package builder
+
+import (
+	"errors"
+	"strings"
+	"text/template"
+)
+
+// ErrUnterminatedAction is returned by ArgsTemplate when an action of the template isn't closed
+var ErrUnterminatedAction = errors.New("unterminated template action")
+
+// ArgsTemplate appends the arguments rendered from the text/template tmpl with data,
+// e.g. ArgsTemplate("convert {{.In}} -resize {{.Size}} {{.Out}}", data). tmpl is split
+// into words on the white space outside of its actions, and each word is rendered as a
+// single argument, so a value with spaces, quotes, or other shell syntax stays one
+// argument and no shell is involved. Words that render empty, like an unmet
+// {{if}}, are dropped. An action can't span words, e.g. a {{range}} around several
+// words. A missing key is an error. If the template can't be parsed or executed,
+// running the command fails.
+func (cmdBuilder *CmdBuilder) ArgsTemplate(tmpl string, data any) *CmdBuilder {
+	args, err := renderArgs(tmpl, data)
+	if err != nil {
+		cmdBuilder.setErr(err)
+		return cmdBuilder
+	}
+	return cmdBuilder.Args(args...)
+}
+
+// renderArgs renders each word of tmpl as an argument
+func renderArgs(tmpl string, data any) ([]string, error) {
+	words, err := splitTemplate(tmpl)
+	if err != nil {
+		return nil, err
+	}
+
+	var args []string
+	var arg strings.Builder
+	for _, word := range words {
+		t, err := template.New("args").Option("missingkey=error").Parse(word)
+		if err != nil {
+			return nil, err
+		}
+
+		arg.Reset()
+		if err := t.Execute(&arg, data); err != nil {
+			return nil, err
+		}
+		if arg.Len() > 0 {
+			args = append(args, arg.String())
+		}
+	}
+	return args, nil
+}
+
+// splitTemplate splits tmpl into words on the white space outside of its {{actions}}
+func splitTemplate(tmpl string) ([]string, error) {
+	var words []string
+	start := -1
+
+	for i := 0; i < len(tmpl); i++ {
+		if strings.HasPrefix(tmpl[i:], "{{") {
+			end, err := actionEnd(tmpl, i+2)
+			if err != nil {
+				return nil, err
+			}
+			if start < 0 {
+				start = i
+			}
+			i = end - 1
+			continue
+		}
+
+		switch tmpl[i] {
+		case ' ', '\t', '\n', '\r':
+			if start >= 0 {
+				words = append(words, tmpl[start:i])
+				start = -1
+			}
+		default:
+			if start < 0 {
+				start = i
+			}
+		}
+	}
+
+	if start >= 0 {
+		words = append(words, tmpl[start:])
+	}
+	return words, nil
+}
+
+// actionEnd returns the index right after the "}}" closing the action whose
+// body starts at i, skipping the strings of the action
+func actionEnd(tmpl string, i int) (int, error) {
+	for ; i < len(tmpl); i++ {
+		switch c := tmpl[i]; c {
+		case '"', '\'', '`':
+			for i++; i < len(tmpl) && tmpl[i] != c; i++ {
+				if tmpl[i] == '\\' && c != '`' {
+					i++
+				}
+			}
+		case '}':
+			if strings.HasPrefix(tmpl[i:], "}}") {
+				return i + 2, nil
+			}
+		}
+	}
+	return 0, ErrUnterminatedAction
+}
@@ -0,0 +1,10 @@
+//go:build aix || linux || solaris || zos
+
+package builder
+
+import "golang.org/x/sys/unix"
+
+const (
+	ioctlGetTermios = unix.TCGETS
+	ioctlSetTermios = unix.TCSETS
+)
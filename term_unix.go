@@ -0,0 +1,47 @@
+//go:build unix
+
+package builder
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// makeRaw puts the terminal f into raw mode and returns its previous state
+func makeRaw(f *os.File) (*unix.Termios, error) {
+	fd := int(f.Fd())
+	old, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err != nil {
+		return nil, err
+	}
+
+	// the same settings as cfmakeraw(3)
+	raw := *old
+	raw.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	raw.Oflag &^= unix.OPOST
+	raw.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	raw.Cflag &^= unix.CSIZE | unix.PARENB
+	raw.Cflag |= unix.CS8
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+
+	if err := unix.IoctlSetTermios(fd, ioctlSetTermios, &raw); err != nil {
+		return nil, err
+	}
+	return old, nil
+}
+
+// restoreTerminal restores the terminal f to a state returned by makeRaw
+func restoreTerminal(f *os.File, state *unix.Termios) error {
+	return unix.IoctlSetTermios(int(f.Fd()), ioctlSetTermios, state)
+}
+
+// eofChar returns the end of file character of the terminal f, ^D if it can't be read
+func eofChar(f *os.File) byte {
+	state, err := unix.IoctlGetTermios(int(f.Fd()), ioctlGetTermios)
+	if err != nil || state.Cc[unix.VEOF] == 0 {
+		return 4
+	}
+	return byte(state.Cc[unix.VEOF])
+}
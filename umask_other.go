@@ -0,0 +1,22 @@
+//go:build !unix
+
+package builder
+
+import (
+	"errors"
+	"runtime"
+)
+
+// ErrUmaskUnsupported is returned when setting the umask of a command
+// isn't supported on the current OS
+var ErrUmaskUnsupported = errors.New("setting the umask is unsupported on " + runtime.GOOS)
+
+// Umask is unsupported on Windows and other systems that aren't Unix.
+// The command returns ErrUmaskUnsupported when started.
+func (cmdBuilder *CmdBuilder) Umask(mask int) *CmdBuilder {
+	cmdBuilder.setErr(ErrUmaskUnsupported)
+	return cmdBuilder
+}
+
+// wrapCmd is a no-op since the umask and resource limits are unsupported outside of Unix
+func (cmdBuilder *CmdBuilder) wrapCmd() {}
@@ -0,0 +1,41 @@
+//go:build unix
+
+package builder
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Umask runs the command with its file mode creation mask set to mask, e.g. 0o022,
+// so the permissions of the files it creates don't depend on the umask of the
+// current process. Since a process can't set the umask of a child without setting
+// its own, the command is run by /bin/sh, which sets the umask and then executes
+// the command. The umask of the current process and other commands is unaffected.
+func (cmdBuilder *CmdBuilder) Umask(mask int) *CmdBuilder {
+	cmdBuilder.umask = &mask
+	return cmdBuilder
+}
+
+// wrapCmd changes the command to be run by /bin/sh, which waits until its niceness
+// is set and sets the umask and resource limits of the process before executing
+// the command, if any are set
+func (cmdBuilder *CmdBuilder) wrapCmd() {
+	var prelude []string
+	if gate := cmdBuilder.state.priority; gate != nil {
+		prelude = append(prelude, gate.prelude()...)
+	}
+	if cmdBuilder.umask != nil {
+		prelude = append(prelude, fmt.Sprintf("umask %04o", *cmdBuilder.umask))
+	}
+	for _, limit := range cmdBuilder.rlimits {
+		prelude = append(prelude, limit.ulimit()...)
+	}
+	if len(prelude) == 0 {
+		return
+	}
+
+	script := strings.Join(append(prelude, `exec "$0" "$@"`), " && ")
+	args := append([]string{"sh", "-c", script, cmdBuilder.cmd.Path}, cmdBuilder.cmd.Args[1:]...)
+	cmdBuilder.cmd.Path, cmdBuilder.cmd.Args = "/bin/sh", args
+}
@@ -0,0 +1,26 @@
+//go:build !unix
+
+package builder
+
+import (
+	"errors"
+	"runtime"
+)
+
+// ErrUserUnsupported is returned when running a command as another user
+// isn't supported on the current OS
+var ErrUserUnsupported = errors.New("running a command as another user is unsupported on " + runtime.GOOS)
+
+// User is unsupported on Windows and other systems that aren't Unix.
+// The command returns ErrUserUnsupported when started.
+func (cmdBuilder *CmdBuilder) User(username string) *CmdBuilder {
+	cmdBuilder.setErr(ErrUserUnsupported)
+	return cmdBuilder
+}
+
+// Credential is unsupported on Windows and other systems that aren't Unix.
+// The command returns ErrUserUnsupported when started.
+func (cmdBuilder *CmdBuilder) Credential(uid, gid uint32) *CmdBuilder {
+	cmdBuilder.setErr(ErrUserUnsupported)
+	return cmdBuilder
+}
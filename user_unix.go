@@ -0,0 +1,67 @@
+//go:build unix
+
+package builder
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// User runs the command as the specified user, including the user's primary and
+// supplementary groups. The calling process must have the privileges to do so.
+// If the user can't be resolved the error is returned when the command is started.
+func (cmdBuilder *CmdBuilder) User(username string) *CmdBuilder {
+	u, err := user.Lookup(username)
+	if err != nil {
+		cmdBuilder.setErr(err)
+		return cmdBuilder
+	}
+
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		cmdBuilder.setErr(fmt.Errorf("user %s: invalid uid %q", username, u.Uid))
+		return cmdBuilder
+	}
+
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		cmdBuilder.setErr(fmt.Errorf("user %s: invalid gid %q", username, u.Gid))
+		return cmdBuilder
+	}
+
+	groupIds, err := u.GroupIds()
+	if err != nil {
+		cmdBuilder.setErr(fmt.Errorf("user %s: %w", username, err))
+		return cmdBuilder
+	}
+
+	var groups []uint32
+	for _, id := range groupIds {
+		group, err := strconv.ParseUint(id, 10, 32)
+		if err != nil {
+			cmdBuilder.setErr(fmt.Errorf("user %s: invalid group id %q", username, id))
+			return cmdBuilder
+		}
+		groups = append(groups, uint32(group))
+	}
+
+	cmdBuilder.sysProcAttr().Credential = &syscall.Credential{
+		Uid:    uint32(uid),
+		Gid:    uint32(gid),
+		Groups: groups,
+	}
+	return cmdBuilder
+}
+
+// Credential runs the command as the specified uid and gid
+// without any supplementary groups
+func (cmdBuilder *CmdBuilder) Credential(uid, gid uint32) *CmdBuilder {
+	cmdBuilder.sysProcAttr().Credential = &syscall.Credential{
+		Uid:         uid,
+		Gid:         gid,
+		NoSetGroups: true,
+	}
+	return cmdBuilder
+}
@@ -0,0 +1,93 @@
+package builder
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// NotFoundError is returned by Validate when the command's executable can't be found
+type NotFoundError struct {
+	Name string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s: executable not found in $PATH", e.Name)
+}
+
+func (e *NotFoundError) Unwrap() error {
+	return exec.ErrNotFound
+}
+
+// Validate checks that the command's executable exists before running it, returning
+// a *NotFoundError if it doesn't. The executable is resolved using the PATH in the
+// command's environment, which may have been overridden with Env. It also checks
+// that the working directory exists, returning a *DirError if it doesn't, unless
+// MkdirDir was set. Every stage of a pipeline is validated.
+func (cmdBuilder *CmdBuilder) Validate() error {
+	for _, stage := range cmdBuilder.stages() {
+		if _, err := stage.lookPath(); err != nil {
+			return err
+		}
+		if !stage.mkdirDir {
+			if err := stage.checkDir(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Available reports whether the command's executable can be found, resolving it
+// the same way as Validate, without running the command
+func (cmdBuilder *CmdBuilder) Available() bool {
+	_, err := cmdBuilder.lookPath()
+	return err == nil
+}
+
+// Available reports whether the named executable can be found in the
+// current process's PATH
+func Available(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+// lookPath resolves the command's executable using the command's environment
+func (cmdBuilder *CmdBuilder) lookPath() (string, error) {
+	name := cmdBuilder.name
+
+	// names with a separator aren't looked up in PATH and are relative to Dir
+	if strings.ContainsRune(name, filepath.Separator) || strings.ContainsRune(name, '/') {
+		if !filepath.IsAbs(name) && cmdBuilder.cmd.Dir != "" {
+			name = filepath.Join(cmdBuilder.cmd.Dir, name)
+		}
+
+		path, err := exec.LookPath(name)
+		if err != nil {
+			return "", &NotFoundError{Name: cmdBuilder.name}
+		}
+		return path, nil
+	}
+
+	path, ok := os.LookupEnv("PATH")
+	if cmdBuilder.cmd.Env != nil {
+		path, ok = getEnv(cmdBuilder.cmd.Env, "PATH")
+	}
+	if !ok {
+		return "", &NotFoundError{Name: name}
+	}
+
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			continue
+		}
+
+		if resolved, err := exec.LookPath(filepath.Join(dir, name)); err == nil {
+			return resolved, nil
+		}
+	}
+
+	return "", &NotFoundError{Name: name}
+}
@@ -0,0 +1,16 @@
+//go:build !plan9
+
+package builder
+
+import (
+	"os"
+	"syscall"
+)
+
+// signaled returns the number of the signal that killed the process, if any
+func signaled(state *os.ProcessState) (int, bool) {
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return int(status.Signal()), true
+	}
+	return 0, false
+}
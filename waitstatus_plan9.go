@@ -0,0 +1,9 @@
+package builder
+
+import "os"
+
+// signaled returns false, processes on Plan 9 exit with a note rather than a
+// signal number
+func signaled(state *os.ProcessState) (int, bool) {
+	return 0, false
+}